@@ -1,6 +1,8 @@
 package ast
 
 import (
+	"fmt"
+	"math/big"
 	"strings"
 
 	"github.com/gavwyh/go-interpreter/token"
@@ -9,6 +11,8 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position // first character of the node
+	End() token.Position // immediately after the last character of the node
 }
 
 type Statement interface {
@@ -42,19 +46,65 @@ type ReturnStatement struct {
 	ReturnValue Expression
 }
 
+type WhileStatement struct {
+	Token token.Token
+	Condition Expression
+	Body *BlockStatement
+}
+
+// for (init; condition; step) { body }, where any of the three clauses may
+// be left out. Init is a let or an expression statement
+type ForStatement struct {
+	Token token.Token
+	Init Statement
+	Condition Expression
+	Step Expression
+	Body *BlockStatement
+}
+
+// for (x in xs) { body } or for (k, v in xs) { body }. Key is nil when
+// only one variable is given
+type ForInStatement struct {
+	Token token.Token
+	Key *Identifier
+	Value *Identifier
+	Iterable Expression
+	Body *BlockStatement
+}
+
+type BreakStatement struct {
+	Token token.Token
+}
+
+type ContinueStatement struct {
+	Token token.Token
+}
+
 type ExpressionStatement struct {
 	Token token.Token 
 	Expression Expression
 }
 
 type BlockStatement struct {
-	Token token.Token
+	Token token.Token // the '{' token
 	Statements []Statement
+	Rbrace token.Token
 }
 
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
+	Big   *big.Int // set instead of Value when the literal overflows an int64
+}
+
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+type StringLiteral struct {
+	Token token.Token
+	Value string // with escape sequences already resolved
 }
 
 type FunctionLiteral struct {
@@ -76,6 +126,54 @@ type InfixExpression struct {
 	Right Expression
 }
 
+// x = 1, xs[0] += 1. Target is an Identifier or an IndexExpression, and
+// Operator is either = or one of the compound forms +=, -=, *= and /=
+type AssignExpression struct {
+	Token token.Token // the operator token
+	Target Expression
+	Operator string
+	Value Expression
+}
+
+// 0..10 counts up to 9, 0..=10 up to 10
+type RangeExpression struct {
+	Token token.Token // the '..' or '..=' token
+	From Expression
+	To Expression
+	Inclusive bool
+}
+
+type CallExpression struct {
+	Token token.Token // the '(' token
+	Function Expression // Identifier or FunctionLiteral
+	Arguments []Expression
+	Rparen token.Token
+}
+
+type ArrayLiteral struct {
+	Token token.Token // the '[' token
+	Elements []Expression
+	Rbracket token.Token
+}
+
+type HashLiteral struct {
+	Token token.Token // the '{' token
+	Pairs []HashPair // in source order
+	Rbrace token.Token
+}
+
+type HashPair struct {
+	Key Expression
+	Value Expression
+}
+
+type IndexExpression struct {
+	Token token.Token // the '[' token
+	Left Expression
+	Index Expression
+	Rbracket token.Token
+}
+
 type IfExpression struct {
 	Token token.Token
 	Condition Expression
@@ -83,6 +181,18 @@ type IfExpression struct {
 	Alternative *BlockStatement
 }
 
+// placeholders left by the parser where it recovered from a syntax error, so
+// that the rest of the tree can still be used
+type BadExpression struct {
+	Token token.Token // first token of the bad expression
+	To token.Position
+}
+
+type BadStatement struct {
+	Token token.Token // first token of the bad statement
+	To token.Position
+}
+
 // root node of every AST
 type Program struct {
 	Statements []Statement
@@ -96,6 +206,20 @@ func (program *Program) TokenLiteral() string {
 	}
 }
 
+func (program *Program) Pos() token.Position {
+	if len(program.Statements) > 0 {
+		return program.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
+func (program *Program) End() token.Position {
+	if len(program.Statements) > 0 {
+		return program.Statements[len(program.Statements)-1].End()
+	}
+	return token.Position{}
+}
+
 // used instead of bytes.buffer for memory optimisation
 func (program *Program) String() string {
 	var out strings.Builder
@@ -110,13 +234,28 @@ func (program *Program) String() string {
 func (i *Identifier) expressionNode() {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
 func (i *Identifier) String() string { return i.Value }
+func (i *Identifier) Pos() token.Position { return i.Token.Pos }
+func (i *Identifier) End() token.Position { return i.Token.End }
 
 func (b *Boolean) expressionNode() {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
 func (b *Boolean) String() string { return b.TokenLiteral() }
+func (b *Boolean) Pos() token.Position { return b.Token.Pos }
+func (b *Boolean) End() token.Position { return b.Token.End }
 
 func (ls *LetStatement) statementNode() {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() token.Position { return ls.Token.Pos }
+
+func (ls *LetStatement) End() token.Position {
+	if ls.Value != nil {
+		return ls.Value.End()
+	}
+	if ls.Name != nil {
+		return ls.Name.End()
+	}
+	return ls.Token.End
+}
 
 func (ls *LetStatement) String() string {
 	var out strings.Builder
@@ -135,6 +274,14 @@ func (ls *LetStatement) String() string {
 
 func (rs *ReturnStatement) statementNode() {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Position { return rs.Token.Pos }
+
+func (rs *ReturnStatement) End() token.Position {
+	if rs.ReturnValue != nil {
+		return rs.ReturnValue.End()
+	}
+	return rs.Token.End
+}
 
 func (rs *ReturnStatement) String() string {
 	var out strings.Builder
@@ -149,9 +296,109 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+func (ws *WhileStatement) statementNode() {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) Pos() token.Position { return ws.Token.Pos }
+
+func (ws *WhileStatement) End() token.Position {
+	if ws.Body != nil {
+		return ws.Body.End()
+	}
+	return ws.Token.End
+}
+
+func (ws *WhileStatement) String() string {
+	var out strings.Builder
+	out.WriteString("while")
+	out.WriteString(ws.Condition.String() + " ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+
+func (fs *ForStatement) statementNode() {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) Pos() token.Position { return fs.Token.Pos }
+
+func (fs *ForStatement) End() token.Position {
+	if fs.Body != nil {
+		return fs.Body.End()
+	}
+	return fs.Token.End
+}
+
+func (fs *ForStatement) String() string {
+	var out strings.Builder
+	out.WriteString("for (")
+
+	if fs.Init != nil {
+		out.WriteString(strings.TrimSuffix(fs.Init.String(), ";"))
+	}
+	out.WriteString("; ")
+
+	if fs.Condition != nil {
+		out.WriteString(fs.Condition.String())
+	}
+	out.WriteString("; ")
+
+	if fs.Step != nil {
+		out.WriteString(fs.Step.String())
+	}
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+func (fs *ForInStatement) statementNode() {}
+func (fs *ForInStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForInStatement) Pos() token.Position { return fs.Token.Pos }
+
+func (fs *ForInStatement) End() token.Position {
+	if fs.Body != nil {
+		return fs.Body.End()
+	}
+	return fs.Token.End
+}
+
+func (fs *ForInStatement) String() string {
+	var out strings.Builder
+	out.WriteString("for (")
+
+	if fs.Key != nil {
+		out.WriteString(fs.Key.String() + ", ")
+	}
+	out.WriteString(fs.Value.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+func (bs *BreakStatement) statementNode() {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) String() string { return bs.TokenLiteral() + ";" }
+func (bs *BreakStatement) Pos() token.Position { return bs.Token.Pos }
+func (bs *BreakStatement) End() token.Position { return bs.Token.End }
+
+func (cs *ContinueStatement) statementNode() {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) String() string { return cs.TokenLiteral() + ";" }
+func (cs *ContinueStatement) Pos() token.Position { return cs.Token.Pos }
+func (cs *ContinueStatement) End() token.Position { return cs.Token.End }
 
 func (es *ExpressionStatement) statementNode() {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position { return es.Token.Pos }
+
+func (es *ExpressionStatement) End() token.Position {
+	if es.Expression != nil {
+		return es.Expression.End()
+	}
+	return es.Token.End
+}
 
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
@@ -162,6 +409,17 @@ func (es *ExpressionStatement) String() string {
 
 func (bs *BlockStatement) statementNode() {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position { return bs.Token.Pos }
+
+func (bs *BlockStatement) End() token.Position {
+	if bs.Rbrace.End.IsValid() {
+		return bs.Rbrace.End
+	}
+	if len(bs.Statements) > 0 {
+		return bs.Statements[len(bs.Statements)-1].End()
+	}
+	return bs.Token.End
+}
 
 func (bs *BlockStatement) String() string {
 	var out strings.Builder
@@ -176,9 +434,62 @@ func (bs *BlockStatement) String() string {
 func (il *IntegerLiteral) expressionNode() {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 func (il *IntegerLiteral) String() string { return il.TokenLiteral() }
+func (il *IntegerLiteral) Pos() token.Position { return il.Token.Pos }
+func (il *IntegerLiteral) End() token.Position { return il.Token.End }
+
+func (fl *FloatLiteral) expressionNode() {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) String() string { return fl.TokenLiteral() }
+func (fl *FloatLiteral) Pos() token.Position { return fl.Token.Pos }
+func (fl *FloatLiteral) End() token.Position { return fl.Token.End }
+
+func (sl *StringLiteral) expressionNode() {}
+func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) String() string { return quote(sl.Value) }
+func (sl *StringLiteral) Pos() token.Position { return sl.Token.Pos }
+func (sl *StringLiteral) End() token.Position { return sl.Token.End }
+
+// the inverse of the lexer's escape handling, so that String() can be lexed
+// back into the same string
+func quote(s string) string {
+	var out strings.Builder
+
+	out.WriteByte('"')
+	for _, ch := range s {
+		switch ch {
+		case '"':
+			out.WriteString(`\"`)
+		case '\\':
+			out.WriteString(`\\`)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\t':
+			out.WriteString(`\t`)
+		case '\r':
+			out.WriteString(`\r`)
+		default:
+			if ch < ' ' || ch == 0x7f {
+				fmt.Fprintf(&out, `\u{%x}`, ch)
+			} else {
+				out.WriteRune(ch)
+			}
+		}
+	}
+	out.WriteByte('"')
+
+	return out.String()
+}
 
 func (fl *FunctionLiteral) expressionNode() {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position { return fl.Token.Pos }
+
+func (fl *FunctionLiteral) End() token.Position {
+	if fl.Body != nil {
+		return fl.Body.End()
+	}
+	return fl.Token.End
+}
 
 func (fl *FunctionLiteral) String() string {
 	var out strings.Builder
@@ -202,6 +513,15 @@ func (pe *PrefixExpression) TokenLiteral() string {
 	return pe.Token.Literal
 }
 
+func (pe *PrefixExpression) Pos() token.Position { return pe.Token.Pos }
+
+func (pe *PrefixExpression) End() token.Position {
+	if pe.Right != nil {
+		return pe.Right.End()
+	}
+	return pe.Token.End
+}
+
 func (pe *PrefixExpression) String() string {
 	var out strings.Builder
 
@@ -218,6 +538,20 @@ func (ie *InfixExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
 
+func (ie *InfixExpression) Pos() token.Position {
+	if ie.Left != nil {
+		return ie.Left.Pos()
+	}
+	return ie.Token.Pos
+}
+
+func (ie *InfixExpression) End() token.Position {
+	if ie.Right != nil {
+		return ie.Right.End()
+	}
+	return ie.Token.End
+}
+
 func (ie *InfixExpression) String() string {
 	var out strings.Builder
 
@@ -230,8 +564,80 @@ func (ie *InfixExpression) String() string {
 	return out.String()
 }
 
+func (ae *AssignExpression) expressionNode() {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+
+func (ae *AssignExpression) Pos() token.Position {
+	if ae.Target != nil {
+		return ae.Target.Pos()
+	}
+	return ae.Token.Pos
+}
+
+func (ae *AssignExpression) End() token.Position {
+	if ae.Value != nil {
+		return ae.Value.End()
+	}
+	return ae.Token.End
+}
+
+func (ae *AssignExpression) String() string {
+	var out strings.Builder
+
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" " + ae.Operator + " ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+func (re *RangeExpression) expressionNode() {}
+func (re *RangeExpression) TokenLiteral() string { return re.Token.Literal }
+
+func (re *RangeExpression) Pos() token.Position {
+	if re.From != nil {
+		return re.From.Pos()
+	}
+	return re.Token.Pos
+}
+
+func (re *RangeExpression) End() token.Position {
+	if re.To != nil {
+		return re.To.End()
+	}
+	return re.Token.End
+}
+
+func (re *RangeExpression) String() string {
+	var out strings.Builder
+
+	out.WriteString("(")
+	out.WriteString(re.From.String())
+	out.WriteString(re.Token.Literal)
+	out.WriteString(re.To.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
 func (ie *IfExpression) expressionNode() {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Position { return ie.Token.Pos }
+
+func (ie *IfExpression) End() token.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+	if ie.Consequence != nil {
+		return ie.Consequence.End()
+	}
+	if ie.Condition != nil {
+		return ie.Condition.End()
+	}
+	return ie.Token.End
+}
 
 func (ie *IfExpression) String() string {
 	var out strings.Builder
@@ -245,4 +651,133 @@ func (ie *IfExpression) String() string {
 	}
 	
 	return out.String()
-}
\ No newline at end of file
+}
+
+func (ce *CallExpression) expressionNode() {}
+func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+
+func (ce *CallExpression) Pos() token.Position {
+	if ce.Function != nil {
+		return ce.Function.Pos()
+	}
+	return ce.Token.Pos
+}
+
+func (ce *CallExpression) End() token.Position {
+	if ce.Rparen.End.IsValid() {
+		return ce.Rparen.End
+	}
+	return ce.Token.End
+}
+
+func (ce *CallExpression) String() string {
+	var out strings.Builder
+
+	args := []string{}
+
+	for _, a := range ce.Arguments {
+		args = append(args, a.String())
+	}
+
+	out.WriteString(ce.Function.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(args, ", "))
+	out.WriteString(")")
+
+	return out.String()
+}
+
+func (al *ArrayLiteral) expressionNode() {}
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position { return al.Token.Pos }
+
+func (al *ArrayLiteral) End() token.Position {
+	if al.Rbracket.End.IsValid() {
+		return al.Rbracket.End
+	}
+	return al.Token.End
+}
+
+func (al *ArrayLiteral) String() string {
+	var out strings.Builder
+
+	elements := []string{}
+
+	for _, e := range al.Elements {
+		elements = append(elements, e.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+func (hl *HashLiteral) expressionNode() {}
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position { return hl.Token.Pos }
+
+func (hl *HashLiteral) End() token.Position {
+	if hl.Rbrace.End.IsValid() {
+		return hl.Rbrace.End
+	}
+	return hl.Token.End
+}
+
+func (hl *HashLiteral) String() string {
+	var out strings.Builder
+
+	pairs := []string{}
+
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+func (ie *IndexExpression) expressionNode() {}
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+
+func (ie *IndexExpression) Pos() token.Position {
+	if ie.Left != nil {
+		return ie.Left.Pos()
+	}
+	return ie.Token.Pos
+}
+
+func (ie *IndexExpression) End() token.Position {
+	if ie.Rbracket.End.IsValid() {
+		return ie.Rbracket.End
+	}
+	return ie.Token.End
+}
+
+func (ie *IndexExpression) String() string {
+	var out strings.Builder
+
+	out.WriteString("(")
+	out.WriteString(ie.Left.String())
+	out.WriteString("[")
+	out.WriteString(ie.Index.String())
+	out.WriteString("])")
+
+	return out.String()
+}
+
+func (be *BadExpression) expressionNode() {}
+func (be *BadExpression) TokenLiteral() string { return be.Token.Literal }
+func (be *BadExpression) String() string { return "<bad expression>" }
+func (be *BadExpression) Pos() token.Position { return be.Token.Pos }
+func (be *BadExpression) End() token.Position { return be.To }
+
+func (bs *BadStatement) statementNode() {}
+func (bs *BadStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BadStatement) String() string { return "<bad statement>" }
+func (bs *BadStatement) Pos() token.Position { return bs.Token.Pos }
+func (bs *BadStatement) End() token.Position { return bs.To }
\ No newline at end of file
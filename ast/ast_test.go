@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/gavwyh/go-interpreter/token"
@@ -26,4 +27,41 @@ func TestString(t *testing.T) {
 	if program.String() != "let x = y;" {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
-}
\ No newline at end of file
+}
+
+func TestFprint(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&ExpressionStatement{
+				Token: token.Token{Type: token.IDENTIFIER, Literal: "x", Pos: token.Position{Offset: 0, Line: 1, Column: 1}},
+				Expression: &RangeExpression{
+					Token: token.Token{Type: token.DOTDOT_EQ, Literal: "..="},
+					From: &Identifier{
+						Token: token.Token{Type: token.IDENTIFIER, Literal: "x", Pos: token.Position{Offset: 0, Line: 1, Column: 1}},
+						Value: "x",
+					},
+					To: &IntegerLiteral{
+						Token: token.Token{Type: token.INT, Literal: "10", Pos: token.Position{Offset: 4, Line: 1, Column: 5}},
+						Value: 10,
+					},
+					Inclusive: true,
+				},
+			},
+		},
+	}
+
+	expected := `Program 1:1
+  Statements[0]: ExpressionStatement 1:1
+    Expression: RangeExpression Inclusive=true 1:1
+      From: Identifier "x" 1:1
+      To: IntegerLiteral 10 1:5
+`
+
+	var out strings.Builder
+	if err := Fprint(&out, program); err != nil {
+		t.Fatalf("Fprint failed: %s", err)
+	}
+	if out.String() != expected {
+		t.Errorf("Fprint wrong.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
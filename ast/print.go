@@ -0,0 +1,110 @@
+package ast
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/gavwyh/go-interpreter/token"
+)
+
+var (
+	tokenType    = reflect.TypeOf(token.Token{})
+	positionType = reflect.TypeOf(token.Position{})
+	bigIntType   = reflect.TypeOf(&big.Int{})
+)
+
+// writes the tree under node one node per line, indented by depth. Each
+// line names the field holding the node, the node's type, its own values
+// such as an identifier's name or an operator, and where it starts:
+//
+//	LetStatement 1:1
+//	  Name: Identifier "x" 1:5
+//	  Value: InfixExpression "+" 1:9
+//	    Left: IntegerLiteral 1 1:9
+//	    Right: IntegerLiteral 2 1:13
+func Fprint(w io.Writer, node Node) error {
+	var out strings.Builder
+	printValue(&out, "", reflect.ValueOf(node), 0)
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+func printValue(out *strings.Builder, label string, v reflect.Value, depth int) {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	indent := strings.Repeat("  ", depth)
+
+	if v.Kind() == reflect.Slice {
+		for i := 0; i < v.Len(); i++ {
+			printValue(out, fmt.Sprintf("%s[%d]: ", strings.TrimSuffix(label, ": "), i), v.Index(i), depth)
+		}
+		return
+	}
+
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	fmt.Fprintf(out, "%s%s%s", indent, label, v.Type().Name())
+
+	var children []int
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Type() == tokenType || field.Type() == positionType {
+			continue
+		}
+		// a literal too large for Value holds it in Big instead
+		if literal, ok := v.Addr().Interface().(*IntegerLiteral); ok && literal.Big != nil && field.Kind() == reflect.Int64 {
+			continue
+		}
+		if scalar, ok := formatScalar(field); ok {
+			if field.Kind() == reflect.Bool {
+				scalar = v.Type().Field(i).Name + "=" + scalar
+			}
+			if scalar != "" {
+				out.WriteString(" " + scalar)
+			}
+		} else {
+			children = append(children, i)
+		}
+	}
+
+	if node, ok := v.Addr().Interface().(Node); ok && node.Pos().IsValid() {
+		out.WriteString(" " + node.Pos().String())
+	}
+	out.WriteString("\n")
+
+	for _, i := range children {
+		printValue(out, v.Type().Field(i).Name+": ", v.Field(i), depth+1)
+	}
+}
+
+// formats the values a node holds itself rather than in child nodes
+func formatScalar(v reflect.Value) (string, bool) {
+	if v.Type() == bigIntType {
+		if v.IsNil() {
+			return "", true
+		}
+		return v.Interface().(*big.Int).String(), true
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return fmt.Sprintf("%q", v.String()), true
+	case reflect.Bool:
+		return fmt.Sprintf("%t", v.Bool()), true
+	case reflect.Int, reflect.Int64:
+		return fmt.Sprintf("%d", v.Int()), true
+	case reflect.Float64:
+		return fmt.Sprintf("%g", v.Float()), true
+	}
+	return "", false
+}
@@ -0,0 +1,201 @@
+package astcodec
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gavwyh/go-interpreter/ast"
+	"github.com/gavwyh/go-interpreter/lexer"
+	"github.com/gavwyh/go-interpreter/parser"
+)
+
+const source = `let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+let xs = [1, 2.5, "three", true, !false, -4, ~5];
+let h = {"a": 1, 2: [3]};
+let big = 123456789012345678901234567890;
+for (let i = 0; i < 10; i += 1) { if (i == 3) { continue; } if (i > 5) { break; } }
+for (k, v in h) { xs[0] = k; }
+for (x in 1..=3) { x }
+while (false) { }
+return fib(10) % h["a"];
+`
+
+func parse(t *testing.T, filename string, source string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.NewFile(filename, source))
+	return p.ParseProgram()
+}
+
+func roundTrip(t *testing.T, program *ast.Program) *ast.Program {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Encode(&buf, program); err != nil {
+		t.Fatalf("Encode failed: %s", err)
+	}
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	return decoded
+}
+
+func TestRoundTrip(t *testing.T) {
+	program := parse(t, "fib.mk", source)
+	decoded := roundTrip(t, program)
+
+	if !reflect.DeepEqual(program, decoded) {
+		var want, got strings.Builder
+		ast.Fprint(&want, program)
+		ast.Fprint(&got, decoded)
+		t.Fatalf("decoded program differs.\nwant=\n%s\ngot=\n%s", want.String(), got.String())
+	}
+
+	statement := decoded.Statements[0].(*ast.LetStatement)
+	if pos := statement.Name.Pos(); pos.Filename != "fib.mk" || pos.Line != 1 || pos.Column != 5 {
+		t.Errorf("wrong position for fib. got=%+v", pos)
+	}
+}
+
+// the parser's recovery leaves bad nodes and nil children behind, and they
+// have to survive too
+func TestRoundTripWithErrors(t *testing.T) {
+	program := parse(t, "", "let = 1; let x = ; 1 + ; fn(a, { }; { x }; add(1, 2")
+	decoded := roundTrip(t, program)
+
+	if !reflect.DeepEqual(program, decoded) {
+		t.Errorf("decoded program differs.\nwant=%q\ngot=%q", program.String(), decoded.String())
+	}
+}
+
+// a nil pointer in an interface field is not the same as a nil interface
+func TestRoundTripNilPointers(t *testing.T) {
+	program := &ast.Program{Statements: []ast.Statement{
+		&ast.ExpressionStatement{Expression: (*ast.Identifier)(nil)},
+		&ast.LetStatement{Name: &ast.Identifier{Value: "x"}, Value: (*ast.BadExpression)(nil)},
+		&ast.ForStatement{Init: (*ast.LetStatement)(nil), Body: (*ast.BlockStatement)(nil)},
+		(*ast.ReturnStatement)(nil),
+	}}
+	decoded := roundTrip(t, program)
+
+	if !reflect.DeepEqual(program, decoded) {
+		var want, got strings.Builder
+		ast.Fprint(&want, program)
+		ast.Fprint(&got, decoded)
+		t.Fatalf("decoded program differs.\nwant=\n%s\ngot=\n%s", want.String(), got.String())
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, parse(t, "", "let x = 1 + 2;")); err != nil {
+		t.Fatalf("Encode failed: %s", err)
+	}
+	encoded := buf.Bytes()
+
+	newer := append([]byte(Magic), FormatVersion+1)
+	newer = append(newer, encoded[len(Magic)+1:]...)
+
+	tests := []struct {
+		input    []byte
+		expected error
+	}{
+		{[]byte("let x = 1;"), ErrNotEncoded},
+		{newer, ErrVersion},
+		{encoded[:len(encoded)-1], ErrMalformed},
+		{append(encoded[:len(encoded):len(encoded)], 0), ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		_, err := Decode(bytes.NewReader(tt.input))
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("wrong error for %q. want=%v, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func entries(t *testing.T, dir string) []string {
+	t.Helper()
+	names, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestCache(t *testing.T) {
+	cache := NewCache(t.TempDir())
+
+	program, diagnostics, err := cache.Parse("fib.mk", source)
+	if err != nil || len(diagnostics) != 0 {
+		t.Fatalf("Parse failed: %v %v", err, diagnostics)
+	}
+	stored := entries(t, cache.Dir)
+	if len(stored) != 1 {
+		t.Fatalf("expected one cache entry. got=%q", stored)
+	}
+
+	cached, _, err := cache.Parse("fib.mk", source)
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	if !reflect.DeepEqual(program, cached) {
+		t.Errorf("cached program differs from the parsed one")
+	}
+
+	// a changed source gets its own entry rather than the old program
+	changed, _, _ := cache.Parse("fib.mk", source+"fib(1);")
+	if len(changed.Statements) != len(program.Statements)+1 {
+		t.Errorf("changed source returned the old program. got=%q", changed.String())
+	}
+	if got := entries(t, cache.Dir); len(got) != 2 {
+		t.Errorf("expected two cache entries. got=%q", got)
+	}
+}
+
+func TestCacheInvalidatesOtherVersions(t *testing.T) {
+	cache := NewCache(t.TempDir())
+	path := cache.path("x.mk", "1 + 2")
+
+	stale := append([]byte(Magic), FormatVersion+1)
+	if err := os.WriteFile(path, stale, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	program, _, err := cache.Parse("x.mk", "1 + 2")
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	if program.String() != "(1 + 2)" {
+		t.Errorf("wrong program. got=%q", program.String())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("stale entry was not replaced: %s", err)
+	}
+}
+
+func TestCacheSkipsProgramsWithErrors(t *testing.T) {
+	cache := NewCache(t.TempDir())
+
+	for i := 0; i < 2; i++ {
+		_, diagnostics, err := cache.Parse("bad.mk", "let = 1;")
+		if err != nil {
+			t.Fatalf("Parse failed: %s", err)
+		}
+		if len(diagnostics) == 0 {
+			t.Errorf("pass %d: expected diagnostics", i)
+		}
+	}
+	if got := entries(t, cache.Dir); len(got) != 0 {
+		t.Errorf("expected no cache entries. got=%q", got)
+	}
+}
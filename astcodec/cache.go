@@ -0,0 +1,81 @@
+package astcodec
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+
+	"github.com/gavwyh/go-interpreter/ast"
+	"github.com/gavwyh/go-interpreter/diagnostic"
+	"github.com/gavwyh/go-interpreter/lexer"
+	"github.com/gavwyh/go-interpreter/parser"
+)
+
+// keeps encoded programs in Dir, one file per source, so that a script that
+// has not changed since it was last run is decoded rather than parsed again.
+// An entry is named by a hash of the filename and source, so a changed
+// source never finds the old entry, and one written in another format
+// version is treated as missing and overwritten
+type Cache struct {
+	Dir string
+}
+
+func NewCache(dir string) *Cache {
+	return &Cache{Dir: dir}
+}
+
+// returns the program for source, from the cache when possible. A program
+// with diagnostics is not cached, as they are not part of the encoding, so
+// parsing it again reports them again. Failing to write an entry is
+// returned as the error alongside the parsed program
+func (c *Cache) Parse(filename string, source string) (*ast.Program, []diagnostic.Diagnostic, error) {
+	path := c.path(filename, source)
+
+	if data, err := os.ReadFile(path); err == nil {
+		if program, err := Decode(bytes.NewReader(data)); err == nil {
+			return program, nil, nil
+		}
+	}
+
+	p := parser.New(lexer.NewFile(filename, source))
+	program := p.ParseProgram()
+
+	diagnostics := p.Errors()
+	if len(diagnostics) != 0 {
+		return program, diagnostics, nil
+	}
+
+	return program, nil, c.store(path, program)
+}
+
+func (c *Cache) path(filename string, source string) string {
+	hash := sha256.New()
+	hash.Write([]byte(filename))
+	hash.Write([]byte{0})
+	hash.Write([]byte(source))
+	return filepath.Join(c.Dir, hex.EncodeToString(hash.Sum(nil))+".ast")
+}
+
+// writes to a temporary file first so that a reader never sees half an entry
+func (c *Cache) store(path string, program *ast.Program) error {
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(c.Dir, "*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err := Encode(file, program); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
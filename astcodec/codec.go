@@ -0,0 +1,633 @@
+package astcodec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+
+	"github.com/gavwyh/go-interpreter/ast"
+	"github.com/gavwyh/go-interpreter/token"
+)
+
+// every encoded program starts with Magic followed by the format version as
+// a uvarint. The version goes up whenever the layout changes, and Decode
+// refuses any other version rather than guess
+const (
+	Magic         = "\x7fAST"
+	FormatVersion = 1
+)
+
+var (
+	ErrNotEncoded = errors.New("not an encoded program")
+	ErrVersion    = errors.New("unsupported format version")
+	ErrMalformed  = errors.New("malformed encoded program")
+)
+
+// after the version comes the name of the file the program was parsed from,
+// then the string table and then the statements. Strings are stored once in
+// the table and referred to by index everywhere else. Each node is a tag
+// byte followed by its fields in declaration order, with 0 for a nil node
+// and tagNilPointer followed by the tag for a nil pointer to a node type.
+// Tokens are stored whole, positions included, so that every span in the
+// decoded tree is the same as in the original
+const (
+	tagNil byte = iota
+	tagIdentifier
+	tagBoolean
+	tagLetStatement
+	tagReturnStatement
+	tagWhileStatement
+	tagForStatement
+	tagForInStatement
+	tagBreakStatement
+	tagContinueStatement
+	tagExpressionStatement
+	tagBlockStatement
+	tagIntegerLiteral
+	tagFloatLiteral
+	tagStringLiteral
+	tagFunctionLiteral
+	tagPrefixExpression
+	tagInfixExpression
+	tagAssignExpression
+	tagRangeExpression
+	tagCallExpression
+	tagArrayLiteral
+	tagHashLiteral
+	tagIndexExpression
+	tagIfExpression
+	tagBadExpression
+	tagBadStatement
+	tagNilPointer
+)
+
+// a nil pointer of each node type, by tag
+var nilNodes = [...]ast.Node{
+	tagIdentifier:          (*ast.Identifier)(nil),
+	tagBoolean:             (*ast.Boolean)(nil),
+	tagLetStatement:        (*ast.LetStatement)(nil),
+	tagReturnStatement:     (*ast.ReturnStatement)(nil),
+	tagWhileStatement:      (*ast.WhileStatement)(nil),
+	tagForStatement:        (*ast.ForStatement)(nil),
+	tagForInStatement:      (*ast.ForInStatement)(nil),
+	tagBreakStatement:      (*ast.BreakStatement)(nil),
+	tagContinueStatement:   (*ast.ContinueStatement)(nil),
+	tagExpressionStatement: (*ast.ExpressionStatement)(nil),
+	tagBlockStatement:      (*ast.BlockStatement)(nil),
+	tagIntegerLiteral:      (*ast.IntegerLiteral)(nil),
+	tagFloatLiteral:        (*ast.FloatLiteral)(nil),
+	tagStringLiteral:       (*ast.StringLiteral)(nil),
+	tagFunctionLiteral:     (*ast.FunctionLiteral)(nil),
+	tagPrefixExpression:    (*ast.PrefixExpression)(nil),
+	tagInfixExpression:     (*ast.InfixExpression)(nil),
+	tagAssignExpression:    (*ast.AssignExpression)(nil),
+	tagRangeExpression:     (*ast.RangeExpression)(nil),
+	tagCallExpression:      (*ast.CallExpression)(nil),
+	tagArrayLiteral:        (*ast.ArrayLiteral)(nil),
+	tagHashLiteral:         (*ast.HashLiteral)(nil),
+	tagIndexExpression:     (*ast.IndexExpression)(nil),
+	tagIfExpression:        (*ast.IfExpression)(nil),
+	tagBadExpression:       (*ast.BadExpression)(nil),
+	tagBadStatement:        (*ast.BadStatement)(nil),
+}
+
+var tags = make(map[reflect.Type]byte)
+
+func init() {
+	for tag, node := range nilNodes {
+		if node != nil {
+			tags[reflect.TypeOf(node)] = byte(tag)
+		}
+	}
+}
+
+type encoder struct {
+	body     bytes.Buffer
+	strings  []string
+	index    map[string]int
+	filename string
+}
+
+// writes program in the binary format. A program comes from a single file,
+// so the filename of its first position is taken to be that of them all
+func Encode(w io.Writer, program *ast.Program) error {
+	e := &encoder{index: make(map[string]int)}
+
+	e.uvarint(uint64(len(program.Statements)))
+	for _, statement := range program.Statements {
+		if err := e.node(statement); err != nil {
+			return err
+		}
+	}
+
+	header := &encoder{}
+	header.body.WriteString(Magic)
+	header.uvarint(FormatVersion)
+	header.rawString(e.filename)
+	header.uvarint(uint64(len(e.strings)))
+	for _, s := range e.strings {
+		header.rawString(s)
+	}
+	header.body.Write(e.body.Bytes())
+
+	_, err := w.Write(header.body.Bytes())
+	return err
+}
+
+func (e *encoder) uvarint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	e.body.Write(buf[:binary.PutUvarint(buf[:], v)])
+}
+
+func (e *encoder) varint(v int64) {
+	var buf [binary.MaxVarintLen64]byte
+	e.body.Write(buf[:binary.PutVarint(buf[:], v)])
+}
+
+func (e *encoder) bool(b bool) {
+	if b {
+		e.body.WriteByte(1)
+	} else {
+		e.body.WriteByte(0)
+	}
+}
+
+func (e *encoder) rawString(s string) {
+	e.uvarint(uint64(len(s)))
+	e.body.WriteString(s)
+}
+
+// writes the index of s in the string table, adding it if it is new
+func (e *encoder) string(s string) {
+	i, ok := e.index[s]
+	if !ok {
+		i = len(e.strings)
+		e.strings = append(e.strings, s)
+		e.index[s] = i
+	}
+	e.uvarint(uint64(i))
+}
+
+// an invalid position is just its zero line
+func (e *encoder) position(pos token.Position) {
+	e.uvarint(uint64(pos.Line))
+	if !pos.IsValid() {
+		return
+	}
+	if e.filename == "" {
+		e.filename = pos.Filename
+	}
+	e.uvarint(uint64(pos.Column))
+	e.uvarint(uint64(pos.Offset))
+}
+
+func (e *encoder) token(tok token.Token) {
+	e.string(string(tok.Type))
+	e.string(tok.Literal)
+	e.position(tok.Pos)
+	e.position(tok.End)
+}
+
+func (e *encoder) nodes(count int, node func(i int) ast.Node) error {
+	e.uvarint(uint64(count))
+	for i := 0; i < count; i++ {
+		if err := e.node(node(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writes node and everything under it. A nil pointer to a node type keeps
+// its type, so that the decoded tree is the same down to its interfaces
+func (e *encoder) node(node ast.Node) error {
+	if node == nil {
+		e.body.WriteByte(tagNil)
+		return nil
+	}
+
+	tag, ok := tags[reflect.TypeOf(node)]
+	if !ok {
+		return fmt.Errorf("cannot encode %T", node)
+	}
+	if reflect.ValueOf(node).IsNil() {
+		e.body.WriteByte(tagNilPointer)
+		e.body.WriteByte(tag)
+		return nil
+	}
+	e.body.WriteByte(tag)
+
+	switch node := node.(type) {
+	case *ast.Identifier:
+		e.token(node.Token)
+		e.string(node.Value)
+	case *ast.Boolean:
+		e.token(node.Token)
+		e.bool(node.Value)
+	case *ast.LetStatement:
+		e.token(node.Token)
+		return e.children(node.Name, node.Value)
+	case *ast.ReturnStatement:
+		e.token(node.Token)
+		return e.children(node.ReturnValue)
+	case *ast.WhileStatement:
+		e.token(node.Token)
+		return e.children(node.Condition, node.Body)
+	case *ast.ForStatement:
+		e.token(node.Token)
+		return e.children(node.Init, node.Condition, node.Step, node.Body)
+	case *ast.ForInStatement:
+		e.token(node.Token)
+		return e.children(node.Key, node.Value, node.Iterable, node.Body)
+	case *ast.BreakStatement:
+		e.token(node.Token)
+	case *ast.ContinueStatement:
+		e.token(node.Token)
+	case *ast.ExpressionStatement:
+		e.token(node.Token)
+		return e.children(node.Expression)
+	case *ast.BlockStatement:
+		e.token(node.Token)
+		e.token(node.Rbrace)
+		return e.nodes(len(node.Statements), func(i int) ast.Node { return node.Statements[i] })
+	case *ast.IntegerLiteral:
+		e.token(node.Token)
+		e.varint(node.Value)
+		if node.Big != nil {
+			e.string(node.Big.String())
+		} else {
+			e.string("")
+		}
+	case *ast.FloatLiteral:
+		e.token(node.Token)
+		e.uvarint(math.Float64bits(node.Value))
+	case *ast.StringLiteral:
+		e.token(node.Token)
+		e.string(node.Value)
+	case *ast.FunctionLiteral:
+		e.token(node.Token)
+		if err := e.nodes(len(node.Parameters), func(i int) ast.Node { return node.Parameters[i] }); err != nil {
+			return err
+		}
+		return e.children(node.Body)
+	case *ast.PrefixExpression:
+		e.token(node.Token)
+		e.string(node.Operator)
+		return e.children(node.Right)
+	case *ast.InfixExpression:
+		e.token(node.Token)
+		e.string(node.Operator)
+		return e.children(node.Left, node.Right)
+	case *ast.AssignExpression:
+		e.token(node.Token)
+		e.string(node.Operator)
+		return e.children(node.Target, node.Value)
+	case *ast.RangeExpression:
+		e.token(node.Token)
+		e.bool(node.Inclusive)
+		return e.children(node.From, node.To)
+	case *ast.CallExpression:
+		e.token(node.Token)
+		e.token(node.Rparen)
+		if err := e.children(node.Function); err != nil {
+			return err
+		}
+		return e.nodes(len(node.Arguments), func(i int) ast.Node { return node.Arguments[i] })
+	case *ast.ArrayLiteral:
+		e.token(node.Token)
+		e.token(node.Rbracket)
+		return e.nodes(len(node.Elements), func(i int) ast.Node { return node.Elements[i] })
+	case *ast.HashLiteral:
+		e.token(node.Token)
+		e.token(node.Rbrace)
+		e.uvarint(uint64(len(node.Pairs)))
+		for _, pair := range node.Pairs {
+			if err := e.children(pair.Key, pair.Value); err != nil {
+				return err
+			}
+		}
+	case *ast.IndexExpression:
+		e.token(node.Token)
+		e.token(node.Rbracket)
+		return e.children(node.Left, node.Index)
+	case *ast.IfExpression:
+		e.token(node.Token)
+		return e.children(node.Condition, node.Consequence, node.Alternative)
+	case *ast.BadExpression:
+		e.token(node.Token)
+		e.position(node.To)
+	case *ast.BadStatement:
+		e.token(node.Token)
+		e.position(node.To)
+	}
+
+	return nil
+}
+
+func (e *encoder) children(nodes ...ast.Node) error {
+	for _, node := range nodes {
+		if err := e.node(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type decoder struct {
+	data     []byte
+	offset   int
+	strings  []string
+	filename string
+	err      error
+}
+
+// reads a program written by Encode. Input that does not start with Magic
+// gives ErrNotEncoded, another format version ErrVersion, and anything
+// else that does not decode ErrMalformed
+func Decode(r io.Reader) (*ast.Program, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(data, []byte(Magic)) {
+		return nil, ErrNotEncoded
+	}
+	d := &decoder{data: data, offset: len(Magic)}
+
+	if version := d.uvarint(); d.err == nil && version != FormatVersion {
+		return nil, fmt.Errorf("%w %d, want %d", ErrVersion, version, FormatVersion)
+	}
+
+	d.filename = d.rawString()
+	d.strings = make([]string, d.count())
+	for i := range d.strings {
+		d.strings[i] = d.rawString()
+	}
+
+	program := &ast.Program{Statements: make([]ast.Statement, d.count())}
+	for i := range program.Statements {
+		program.Statements[i] = d.statement()
+	}
+
+	if d.err == nil && d.offset != len(d.data) {
+		d.fail()
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return program, nil
+}
+
+// the first problem is kept, and every read after it returns zero values
+func (d *decoder) fail() {
+	if d.err == nil {
+		d.err = ErrMalformed
+	}
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data[d.offset:])
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.offset += n
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.data[d.offset:])
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.offset += n
+	return v
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil || d.offset >= len(d.data) {
+		d.fail()
+		return 0
+	}
+	b := d.data[d.offset]
+	d.offset++
+	return b
+}
+
+func (d *decoder) bool() bool {
+	return d.byte() == 1
+}
+
+// the length of a list, which can be no more than the bytes left as every
+// element takes at least one
+func (d *decoder) count() int {
+	n := d.uvarint()
+	if n > uint64(len(d.data)-d.offset) {
+		d.fail()
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) rawString() string {
+	n := d.count()
+	if d.err != nil {
+		return ""
+	}
+	s := string(d.data[d.offset : d.offset+n])
+	d.offset += n
+	return s
+}
+
+func (d *decoder) string() string {
+	i := d.uvarint()
+	if i >= uint64(len(d.strings)) {
+		d.fail()
+		return ""
+	}
+	return d.strings[i]
+}
+
+func (d *decoder) position() token.Position {
+	line := d.uvarint()
+	if line == 0 {
+		return token.Position{}
+	}
+	column := d.uvarint()
+	offset := d.uvarint()
+	return token.Position{Filename: d.filename, Offset: int(offset), Line: int(line), Column: int(column)}
+}
+
+func (d *decoder) token() token.Token {
+	return token.Token{
+		Type:    token.TokenType(d.string()),
+		Literal: d.string(),
+		Pos:     d.position(),
+		End:     d.position(),
+	}
+}
+
+func (d *decoder) statement() ast.Statement {
+	node := d.node()
+	if node == nil {
+		return nil
+	}
+	statement, ok := node.(ast.Statement)
+	if !ok {
+		d.fail()
+	}
+	return statement
+}
+
+func (d *decoder) expression() ast.Expression {
+	node := d.node()
+	if node == nil {
+		return nil
+	}
+	expression, ok := node.(ast.Expression)
+	if !ok {
+		d.fail()
+	}
+	return expression
+}
+
+func (d *decoder) identifier() *ast.Identifier {
+	node := d.node()
+	if node == nil {
+		return nil
+	}
+	identifier, ok := node.(*ast.Identifier)
+	if !ok {
+		d.fail()
+	}
+	return identifier
+}
+
+func (d *decoder) block() *ast.BlockStatement {
+	node := d.node()
+	if node == nil {
+		return nil
+	}
+	block, ok := node.(*ast.BlockStatement)
+	if !ok {
+		d.fail()
+	}
+	return block
+}
+
+func (d *decoder) expressions() []ast.Expression {
+	expressions := make([]ast.Expression, d.count())
+	for i := range expressions {
+		expressions[i] = d.expression()
+	}
+	return expressions
+}
+
+func (d *decoder) node() ast.Node {
+	tag := d.byte()
+	if d.err != nil || tag == tagNil {
+		return nil
+	}
+
+	switch tag {
+	case tagNilPointer:
+		tag := d.byte()
+		if int(tag) >= len(nilNodes) || nilNodes[tag] == nil {
+			d.fail()
+			return nil
+		}
+		return nilNodes[tag]
+	case tagIdentifier:
+		return &ast.Identifier{Token: d.token(), Value: d.string()}
+	case tagBoolean:
+		return &ast.Boolean{Token: d.token(), Value: d.bool()}
+	case tagLetStatement:
+		return &ast.LetStatement{Token: d.token(), Name: d.identifier(), Value: d.expression()}
+	case tagReturnStatement:
+		return &ast.ReturnStatement{Token: d.token(), ReturnValue: d.expression()}
+	case tagWhileStatement:
+		return &ast.WhileStatement{Token: d.token(), Condition: d.expression(), Body: d.block()}
+	case tagForStatement:
+		return &ast.ForStatement{Token: d.token(), Init: d.statement(), Condition: d.expression(), Step: d.expression(), Body: d.block()}
+	case tagForInStatement:
+		return &ast.ForInStatement{Token: d.token(), Key: d.identifier(), Value: d.identifier(), Iterable: d.expression(), Body: d.block()}
+	case tagBreakStatement:
+		return &ast.BreakStatement{Token: d.token()}
+	case tagContinueStatement:
+		return &ast.ContinueStatement{Token: d.token()}
+	case tagExpressionStatement:
+		return &ast.ExpressionStatement{Token: d.token(), Expression: d.expression()}
+	case tagBlockStatement:
+		block := &ast.BlockStatement{Token: d.token(), Rbrace: d.token()}
+		block.Statements = make([]ast.Statement, d.count())
+		for i := range block.Statements {
+			block.Statements[i] = d.statement()
+		}
+		return block
+	case tagIntegerLiteral:
+		literal := &ast.IntegerLiteral{Token: d.token(), Value: d.varint()}
+		if text := d.string(); text != "" {
+			value, ok := new(big.Int).SetString(text, 10)
+			if !ok {
+				d.fail()
+			}
+			literal.Big = value
+		}
+		return literal
+	case tagFloatLiteral:
+		return &ast.FloatLiteral{Token: d.token(), Value: math.Float64frombits(d.uvarint())}
+	case tagStringLiteral:
+		return &ast.StringLiteral{Token: d.token(), Value: d.string()}
+	case tagFunctionLiteral:
+		function := &ast.FunctionLiteral{Token: d.token()}
+		function.Parameters = make([]*ast.Identifier, d.count())
+		for i := range function.Parameters {
+			function.Parameters[i] = d.identifier()
+		}
+		function.Body = d.block()
+		return function
+	case tagPrefixExpression:
+		return &ast.PrefixExpression{Token: d.token(), Operator: d.string(), Right: d.expression()}
+	case tagInfixExpression:
+		return &ast.InfixExpression{Token: d.token(), Operator: d.string(), Left: d.expression(), Right: d.expression()}
+	case tagAssignExpression:
+		return &ast.AssignExpression{Token: d.token(), Operator: d.string(), Target: d.expression(), Value: d.expression()}
+	case tagRangeExpression:
+		return &ast.RangeExpression{Token: d.token(), Inclusive: d.bool(), From: d.expression(), To: d.expression()}
+	case tagCallExpression:
+		return &ast.CallExpression{Token: d.token(), Rparen: d.token(), Function: d.expression(), Arguments: d.expressions()}
+	case tagArrayLiteral:
+		return &ast.ArrayLiteral{Token: d.token(), Rbracket: d.token(), Elements: d.expressions()}
+	case tagHashLiteral:
+		hash := &ast.HashLiteral{Token: d.token(), Rbrace: d.token()}
+		hash.Pairs = make([]ast.HashPair, d.count())
+		for i := range hash.Pairs {
+			hash.Pairs[i] = ast.HashPair{Key: d.expression(), Value: d.expression()}
+		}
+		return hash
+	case tagIndexExpression:
+		return &ast.IndexExpression{Token: d.token(), Rbracket: d.token(), Left: d.expression(), Index: d.expression()}
+	case tagIfExpression:
+		return &ast.IfExpression{Token: d.token(), Condition: d.expression(), Consequence: d.block(), Alternative: d.block()}
+	case tagBadExpression:
+		return &ast.BadExpression{Token: d.token(), To: d.position()}
+	case tagBadStatement:
+		return &ast.BadStatement{Token: d.token(), To: d.position()}
+	}
+
+	d.fail()
+	return nil
+}
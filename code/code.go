@@ -0,0 +1,280 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// a sequence of instructions, each an opcode byte followed by its operands
+// in big-endian order
+type Instructions []byte
+
+type Opcode byte
+
+const (
+	// pushes the constant at the operand's index in the constant pool
+	OpConstant Opcode = iota
+	OpPop
+	OpDup
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	// infix operators pop the right operand and then the left one, and push
+	// the result
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
+	OpEqual
+	OpNotEqual
+	OpLessThan
+	OpGreaterThan
+	OpLessEqual
+	OpGreaterEqual
+
+	OpMinus
+	OpBang
+	OpComplement
+
+	// jump to the absolute offset in the operand. OpJumpNotTruthy pops the
+	// condition first
+	OpJump
+	OpJumpNotTruthy
+
+	OpGetGlobal
+	OpSetGlobal
+	// like OpSetGlobal, but fails if the global has not been defined, as an
+	// assignment does
+	OpAssignGlobal
+	OpGetLocal
+	OpSetLocal
+	// clears the second operand's number of local slots starting at the
+	// first, so that the variables of a new loop pass are fresh bindings
+	OpClearLocals
+	OpGetBuiltin
+	OpGetFree
+	OpSetFree
+
+	OpArray
+	OpHash
+	OpIndex
+	// pops the value, the index and the indexed object, in that order. The
+	// operand picks the assignment operator from AssignOperators
+	OpSetIndex
+	OpRange
+
+	// replaces the iterable on top of the stack with an iterator over it
+	OpIterator
+	// takes the next element from the iterator on top of the stack, leaving
+	// the iterator there, and pushes the key and value when the second
+	// operand is 1 or just the loop element when it is 0. Jumps to the first
+	// operand once the iterator is done
+	OpIterNext
+
+	// the operand is the number of arguments, which sit on the stack above
+	// the function being called
+	OpCall
+	// a call the function returns the result of, which reuses the caller's
+	// frame instead of pushing a new one
+	OpTailCall
+	OpReturnValue
+
+	// pushes a local slot of the current frame, turned into a cell if it is
+	// not one already, so that a closure can share the variable
+	OpCaptureLocal
+	// pushes the cell holding one of the current closure's free variables
+	OpCaptureFree
+	// the operands are the index of a compiled function in the constant pool
+	// and the number of captured cells on the stack above it
+	OpClosure
+)
+
+// the assignment operators OpSetIndex can apply, by operand
+var AssignOperators = []string{"=", "+=", "-=", "*=", "/="}
+
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+	OpDup:      {"OpDup", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpAdd:          {"OpAdd", []int{}},
+	OpSub:          {"OpSub", []int{}},
+	OpMul:          {"OpMul", []int{}},
+	OpDiv:          {"OpDiv", []int{}},
+	OpMod:          {"OpMod", []int{}},
+	OpBitAnd:       {"OpBitAnd", []int{}},
+	OpBitOr:        {"OpBitOr", []int{}},
+	OpBitXor:       {"OpBitXor", []int{}},
+	OpShiftLeft:    {"OpShiftLeft", []int{}},
+	OpShiftRight:   {"OpShiftRight", []int{}},
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpLessThan:     {"OpLessThan", []int{}},
+	OpGreaterThan:  {"OpGreaterThan", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+
+	OpMinus:      {"OpMinus", []int{}},
+	OpBang:       {"OpBang", []int{}},
+	OpComplement: {"OpComplement", []int{}},
+
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+
+	OpGetGlobal:    {"OpGetGlobal", []int{2}},
+	OpSetGlobal:    {"OpSetGlobal", []int{2}},
+	OpAssignGlobal: {"OpAssignGlobal", []int{2}},
+	OpGetLocal:     {"OpGetLocal", []int{1}},
+	OpSetLocal:     {"OpSetLocal", []int{1}},
+	OpClearLocals:  {"OpClearLocals", []int{1, 1}},
+	OpGetBuiltin:   {"OpGetBuiltin", []int{1}},
+	OpGetFree:      {"OpGetFree", []int{1}},
+	OpSetFree:      {"OpSetFree", []int{1}},
+
+	OpArray:    {"OpArray", []int{2}},
+	OpHash:     {"OpHash", []int{2}},
+	OpIndex:    {"OpIndex", []int{}},
+	OpSetIndex: {"OpSetIndex", []int{1}},
+	OpRange:    {"OpRange", []int{1}},
+
+	OpIterator: {"OpIterator", []int{}},
+	OpIterNext: {"OpIterNext", []int{2, 1}},
+
+	OpCall:        {"OpCall", []int{1}},
+	OpTailCall:    {"OpTailCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+
+	OpCaptureLocal: {"OpCaptureLocal", []int{1}},
+	OpCaptureFree:  {"OpCaptureFree", []int{1}},
+	OpClosure:      {"OpClosure", []int{2, 1}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// reports whether operand can be encoded in width bytes
+func Fits(width int, operand int) bool {
+	return operand >= 0 && operand < 1<<(8*width)
+}
+
+// encodes an instruction, and an unknown opcode gives an empty instruction.
+// Operands that do not fit their width are truncated, so callers check them
+// with Fits first
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	length := 1
+	for _, width := range def.OperandWidths {
+		length += width
+	}
+
+	instruction := make([]byte, length)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, operand := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(operand))
+		case 1:
+			instruction[offset] = byte(operand)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// decodes the operands that follow an opcode, and returns them with the
+// number of bytes they took up
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
+// disassembles the instructions one per line, each prefixed with its offset
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	if len(operands) != len(def.OperandWidths) {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n",
+			len(operands), len(def.OperandWidths))
+	}
+
+	switch len(operands) {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operand count for %s\n", def.Name)
+}
@@ -0,0 +1,871 @@
+package compiler
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gavwyh/go-interpreter/ast"
+	"github.com/gavwyh/go-interpreter/code"
+	"github.com/gavwyh/go-interpreter/evaluator"
+	"github.com/gavwyh/go-interpreter/object"
+)
+
+// the most local slots a frame can have and the most variables a closure
+// can capture, as both are addressed by a one byte operand
+const MaxLocals = math.MaxUint8 + 1
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// a loop being compiled, with the jumps its break and continue statements
+// left to be pointed at the right place once it is known
+type loop struct {
+	breaks    []int
+	continues []int
+
+	// the pending values of the scope when the loop started
+	pending int
+}
+
+// the instructions of the function being compiled, or of the program itself
+// for the outermost scope
+type CompilationScope struct {
+	instructions        code.Instructions
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+	loops               []*loop
+
+	// values an enclosing expression has pushed and not yet used, such as
+	// the 1 in 1 + if (c) { break }. A break or continue pops them before
+	// it jumps, so that the loop finds the stack as it left it
+	pending int
+}
+
+// lowers a program into instructions for the vm. Statements leave the stack
+// as they found it, expressions push exactly one value
+type Compiler struct {
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// the first operand that did not fit, which Compile reports once done
+	err error
+}
+
+func New() *Compiler {
+	symbolTable := NewSymbolTable()
+	for i, builtin := range evaluator.Builtins {
+		symbolTable.DefineBuiltin(i, builtin.Name)
+	}
+
+	return &Compiler{
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{{}},
+	}
+}
+
+// a compiler that carries on from the globals and constants of an earlier
+// one, so that the REPL can compile one line at a time
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	compiler := New()
+	compiler.symbolTable = s
+	compiler.constants = constants
+
+	// loop variables at the top level only live as long as one program
+	s.localNames = nil
+	return compiler
+}
+
+// the result of compiling a program
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+
+	// the local slots the program's own frame needs for the variables of
+	// loops at the top level, and their names
+	NumLocals  int
+	LocalNames []string
+
+	// by index, for reporting a global that is read before it is defined
+	GlobalNames []string
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	global := c.symbolTable.global()
+
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+		NumLocals:    len(global.localNames),
+		LocalNames:   global.localNames,
+		GlobalNames:  global.globalNames,
+	}
+}
+
+// compiles node, failing as well if an operand such as a constant index or
+// a jump target came out too large for its width in the instruction
+func (c *Compiler) Compile(node ast.Node) error {
+	if err := c.compile(node); err != nil {
+		return err
+	}
+	return c.err
+}
+
+func (c *Compiler) compile(node ast.Node) error {
+	switch node := node.(type) {
+
+	// statements
+	case *ast.Program:
+		for _, s := range node.Statements {
+			if err := c.compile(s); err != nil {
+				return err
+			}
+		}
+	case *ast.ExpressionStatement:
+		if err := c.compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.compile(s); err != nil {
+				return err
+			}
+		}
+	case *ast.LetStatement:
+		return c.compileLetStatement(node)
+	case *ast.ReturnStatement:
+		if node.ReturnValue == nil {
+			c.emit(code.OpNull)
+		} else if err := c.compileTail(node.ReturnValue); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+	case *ast.WhileStatement:
+		return c.compileWhileStatement(node)
+	case *ast.ForStatement:
+		return c.compileForStatement(node)
+	case *ast.ForInStatement:
+		return c.compileForInStatement(node)
+	case *ast.BreakStatement:
+		return c.compileLoopControl(node.Token.Literal, func(l *loop, jump int) { l.breaks = append(l.breaks, jump) })
+	case *ast.ContinueStatement:
+		return c.compileLoopControl(node.Token.Literal, func(l *loop, jump int) { l.continues = append(l.continues, jump) })
+	case *ast.BadStatement:
+		return fmt.Errorf("cannot compile bad statement at %s", node.Pos())
+
+	// expressions
+	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			c.emit(code.OpConstant, c.addConstant(&object.BigInt{Value: node.Big}))
+		} else {
+			c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: node.Value}))
+		}
+	case *ast.FloatLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Float{Value: node.Value}))
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Value}))
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.Identifier:
+		c.loadSymbol(c.resolve(node.Value))
+	case *ast.PrefixExpression:
+		if err := c.compile(node.Right); err != nil {
+			return err
+		}
+		op, ok := prefixOperators[node.Operator]
+		if !ok {
+			return fmt.Errorf("unknown operator: %s", node.Operator)
+		}
+		c.emit(op)
+	case *ast.InfixExpression:
+		return c.compileInfixExpression(node)
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(node)
+	case *ast.IfExpression:
+		return c.compileIfExpression(node, false)
+	case *ast.RangeExpression:
+		if err := c.compile(node.From); err != nil {
+			return err
+		}
+		if err := c.compileAbove(1, node.To); err != nil {
+			return err
+		}
+		inclusive := 0
+		if node.Inclusive {
+			inclusive = 1
+		}
+		c.emit(code.OpRange, inclusive)
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node)
+	case *ast.ArrayLiteral:
+		for i, element := range node.Elements {
+			if err := c.compileAbove(i, element); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+	case *ast.HashLiteral:
+		for i, pair := range node.Pairs {
+			if err := c.compileAbove(i*2, pair.Key); err != nil {
+				return err
+			}
+			if err := c.compileAbove(i*2+1, pair.Value); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs)*2)
+	case *ast.IndexExpression:
+		if err := c.compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.compileAbove(1, node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+	case *ast.CallExpression:
+		return c.compileCallExpression(node, code.OpCall)
+	case *ast.BadExpression:
+		return fmt.Errorf("cannot compile bad expression at %s", node.Pos())
+	default:
+		return fmt.Errorf("cannot compile %T", node)
+	}
+
+	return nil
+}
+
+var prefixOperators = map[string]code.Opcode{
+	"-": code.OpMinus,
+	"!": code.OpBang,
+	"~": code.OpComplement,
+}
+
+var infixOperators = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"&":  code.OpBitAnd,
+	"|":  code.OpBitOr,
+	"^":  code.OpBitXor,
+	"<<": code.OpShiftLeft,
+	">>": code.OpShiftRight,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	"<":  code.OpLessThan,
+	">":  code.OpGreaterThan,
+	"<=": code.OpLessEqual,
+	">=": code.OpGreaterEqual,
+}
+
+// a function literal is bound before it is compiled so that its body can
+// call it, but any other value is compiled first, so that in let x = x + 1
+// the x on the right is still the one from the enclosing scope
+func (c *Compiler) compileLetStatement(node *ast.LetStatement) error {
+	_, isFunction := node.Value.(*ast.FunctionLiteral)
+
+	var symbol Symbol
+	if isFunction {
+		symbol = c.symbolTable.Define(node.Name.Value)
+	}
+
+	if node.Value == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compile(node.Value); err != nil {
+		return err
+	}
+
+	if !isFunction {
+		symbol = c.symbolTable.Define(node.Name.Value)
+	}
+	if err := c.checkLocals(); err != nil {
+		return err
+	}
+
+	c.storeSymbol(symbol, false)
+	return nil
+}
+
+// && and || jump over their right operand when the left one already decides
+// the result, and always produce a boolean
+func (c *Compiler) compileInfixExpression(node *ast.InfixExpression) error {
+	if err := c.compile(node.Left); err != nil {
+		return err
+	}
+
+	switch node.Operator {
+	case "&&":
+		toFalse := c.emit(code.OpJumpNotTruthy, 9999)
+		if err := c.compile(node.Right); err != nil {
+			return err
+		}
+		rightFalse := c.emit(code.OpJumpNotTruthy, 9999)
+		c.emit(code.OpTrue)
+		toEnd := c.emit(code.OpJump, 9999)
+		c.changeOperand(toFalse, len(c.currentInstructions()))
+		c.changeOperand(rightFalse, len(c.currentInstructions()))
+		c.emit(code.OpFalse)
+		c.changeOperand(toEnd, len(c.currentInstructions()))
+		return nil
+	case "||":
+		toRight := c.emit(code.OpJumpNotTruthy, 9999)
+		c.emit(code.OpTrue)
+		leftTrue := c.emit(code.OpJump, 9999)
+		c.changeOperand(toRight, len(c.currentInstructions()))
+		if err := c.compile(node.Right); err != nil {
+			return err
+		}
+		rightFalse := c.emit(code.OpJumpNotTruthy, 9999)
+		c.emit(code.OpTrue)
+		rightTrue := c.emit(code.OpJump, 9999)
+		c.changeOperand(rightFalse, len(c.currentInstructions()))
+		c.emit(code.OpFalse)
+		c.changeOperand(leftTrue, len(c.currentInstructions()))
+		c.changeOperand(rightTrue, len(c.currentInstructions()))
+		return nil
+	}
+
+	if err := c.compileAbove(1, node.Right); err != nil {
+		return err
+	}
+
+	op, ok := infixOperators[node.Operator]
+	if !ok {
+		return fmt.Errorf("unknown operator: %s", node.Operator)
+	}
+	c.emit(op)
+	return nil
+}
+
+// leaves the assigned value on the stack, as an assignment is an expression
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		symbol := c.resolve(target.Value)
+		if symbol.Scope == BuiltinScope {
+			return fmt.Errorf("identifier not found: %s", target.Value)
+		}
+
+		operator := node.Operator[:len(node.Operator)-1]
+		loaded := 0
+		if operator != "" {
+			c.loadSymbol(symbol)
+			loaded = 1
+		}
+		if err := c.compileAbove(loaded, node.Value); err != nil {
+			return err
+		}
+		if operator != "" {
+			c.emit(infixOperators[operator])
+		}
+
+		c.emit(code.OpDup)
+		c.storeSymbol(symbol, true)
+	case *ast.IndexExpression:
+		if err := c.compile(target.Left); err != nil {
+			return err
+		}
+		if err := c.compileAbove(1, target.Index); err != nil {
+			return err
+		}
+		if err := c.compileAbove(2, node.Value); err != nil {
+			return err
+		}
+
+		for i, operator := range code.AssignOperators {
+			if operator == node.Operator {
+				c.emit(code.OpSetIndex, i)
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown operator: %s", node.Operator)
+	default:
+		return fmt.Errorf("cannot assign to %s", node.Target.String())
+	}
+
+	return nil
+}
+
+// in tail position the last expression of each branch is compiled as a
+// tail expression too
+func (c *Compiler) compileIfExpression(node *ast.IfExpression, tail bool) error {
+	if err := c.compile(node.Condition); err != nil {
+		return err
+	}
+
+	toAlternative := c.emit(code.OpJumpNotTruthy, 9999)
+	if err := c.compileBlockValue(node.Consequence, tail); err != nil {
+		return err
+	}
+	toEnd := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(toAlternative, len(c.currentInstructions()))
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileBlockValue(node.Alternative, tail); err != nil {
+		return err
+	}
+
+	c.changeOperand(toEnd, len(c.currentInstructions()))
+	return nil
+}
+
+// compiles a block so that it leaves the value of its last expression on
+// the stack, or null if it does not end with one
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement, tail bool) error {
+	statements := block.Statements
+
+	for i, s := range statements {
+		last, ok := s.(*ast.ExpressionStatement)
+		if tail && ok && i == len(statements)-1 {
+			return c.compileTail(last.Expression)
+		}
+		if err := c.compile(s); err != nil {
+			return err
+		}
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+// compiles an expression whose value the current function returns, so that
+// a call there can reuse the function's frame. The program itself has no
+// caller to return to, so its calls never are
+func (c *Compiler) compileTail(expression ast.Expression) error {
+	if c.scopeIndex == 0 {
+		return c.compile(expression)
+	}
+
+	switch expression := expression.(type) {
+	case *ast.CallExpression:
+		return c.compileCallExpression(expression, code.OpTailCall)
+	case *ast.IfExpression:
+		return c.compileIfExpression(expression, true)
+	default:
+		return c.compile(expression)
+	}
+}
+
+func (c *Compiler) compileCallExpression(node *ast.CallExpression, op code.Opcode) error {
+	if err := c.compile(node.Function); err != nil {
+		return err
+	}
+
+	for i, argument := range node.Arguments {
+		if err := c.compileAbove(i+1, argument); err != nil {
+			return err
+		}
+	}
+
+	c.emit(op, len(node.Arguments))
+	return nil
+}
+
+// loops are statements, so like an expression statement they leave nothing
+// on the stack. They still push and pop a null, so that a block ending in a
+// loop has null as its value
+func (c *Compiler) compileWhileStatement(node *ast.WhileStatement) error {
+	start := len(c.currentInstructions())
+	if err := c.compile(node.Condition); err != nil {
+		return err
+	}
+	toExit := c.emit(code.OpJumpNotTruthy, 9999)
+
+	l := c.enterLoop()
+	if err := c.compile(node.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, start)
+	c.leaveLoop(l, start)
+
+	c.changeOperand(toExit, len(c.currentInstructions()))
+	c.emitLoopValue()
+	return nil
+}
+
+// the init clause and the body share one scope for the whole loop, which is
+// cleared each time the loop starts
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	c.enterBlock()
+	reset := c.emitClearLocals()
+
+	if node.Init != nil {
+		if err := c.compile(node.Init); err != nil {
+			return err
+		}
+	}
+
+	start := len(c.currentInstructions())
+	toExit := -1
+	if node.Condition != nil {
+		if err := c.compile(node.Condition); err != nil {
+			return err
+		}
+		toExit = c.emit(code.OpJumpNotTruthy, 9999)
+	}
+
+	l := c.enterLoop()
+	if err := c.compile(node.Body); err != nil {
+		return err
+	}
+
+	next := len(c.currentInstructions())
+	if node.Step != nil {
+		if err := c.compile(node.Step); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	}
+	c.emit(code.OpJump, start)
+	c.leaveLoop(l, next)
+
+	if toExit != -1 {
+		c.changeOperand(toExit, len(c.currentInstructions()))
+	}
+	if err := c.leaveBlock(reset); err != nil {
+		return err
+	}
+	c.emitLoopValue()
+	return nil
+}
+
+// the iterator stays on the stack for the whole loop. Each pass clears the
+// scope of the loop variables, so that a closure created in the body keeps
+// the values from its own pass
+func (c *Compiler) compileForInStatement(node *ast.ForInStatement) error {
+	if err := c.compile(node.Iterable); err != nil {
+		return err
+	}
+	c.emit(code.OpIterator)
+
+	c.enterBlock()
+	start := len(c.currentInstructions())
+	reset := c.emitClearLocals()
+
+	pairs := 0
+	if node.Key != nil {
+		pairs = 1
+	}
+	next := c.emit(code.OpIterNext, 9999, pairs)
+
+	value := c.symbolTable.Define(node.Value.Value)
+	if node.Key != nil {
+		key := c.symbolTable.Define(node.Key.Value)
+		c.storeSymbol(value, false)
+		c.storeSymbol(key, false)
+	} else {
+		c.storeSymbol(value, false)
+	}
+
+	l := c.enterLoop()
+	if err := c.compile(node.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, start)
+	c.leaveLoop(l, start)
+
+	c.changeOperand(next, len(c.currentInstructions()))
+	c.emit(code.OpPop)
+	if err := c.leaveBlock(reset); err != nil {
+		return err
+	}
+	c.emitLoopValue()
+	return nil
+}
+
+func (c *Compiler) emitLoopValue() {
+	c.emit(code.OpNull)
+	c.emit(code.OpPop)
+}
+
+// emits a jump for break or continue, which record adds to the innermost
+// loop to be pointed at its target later
+func (c *Compiler) compileLoopControl(keyword string, record func(*loop, int)) error {
+	scope := c.scopes[c.scopeIndex]
+	if len(scope.loops) == 0 {
+		return fmt.Errorf("%s is not inside a loop", keyword)
+	}
+
+	l := scope.loops[len(scope.loops)-1]
+	for i := l.pending; i < scope.pending; i++ {
+		c.emit(code.OpPop)
+	}
+	record(l, c.emit(code.OpJump, 9999))
+	return nil
+}
+
+// compiles node while count values pushed just before it are still on the
+// stack waiting for it, e.g the function and earlier arguments of a call
+func (c *Compiler) compileAbove(count int, node ast.Node) error {
+	c.scopes[c.scopeIndex].pending += count
+	err := c.compile(node)
+	c.scopes[c.scopeIndex].pending -= count
+	return err
+}
+
+func (c *Compiler) enterLoop() *loop {
+	l := &loop{pending: c.scopes[c.scopeIndex].pending}
+	c.scopes[c.scopeIndex].loops = append(c.scopes[c.scopeIndex].loops, l)
+	return l
+}
+
+// points the loop's continue statements at next, and its break statements
+// at whatever comes after the loop's final jump
+func (c *Compiler) leaveLoop(l *loop, next int) {
+	for _, position := range l.continues {
+		c.changeOperand(position, next)
+	}
+	for _, position := range l.breaks {
+		c.changeOperand(position, len(c.currentInstructions()))
+	}
+
+	loops := c.scopes[c.scopeIndex].loops
+	c.scopes[c.scopeIndex].loops = loops[:len(loops)-1]
+}
+
+func (c *Compiler) enterBlock() {
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+}
+
+// emits an OpClearLocals for the slots the block is about to define, whose
+// count leaveBlock fills in
+func (c *Compiler) emitClearLocals() int {
+	return c.emit(code.OpClearLocals, len(c.symbolTable.frame().localNames), 0)
+}
+
+func (c *Compiler) leaveBlock(reset int) error {
+	if err := c.checkLocals(); err != nil {
+		return err
+	}
+
+	ins := c.currentInstructions()
+	first := int(code.ReadUint8(ins[reset+1:]))
+	count := len(c.symbolTable.frame().localNames) - first
+	c.replaceInstruction(reset, c.make(code.OpClearLocals, first, count))
+
+	c.symbolTable = c.symbolTable.Outer
+	return nil
+}
+
+// the body is compiled as a tail block, so the function always ends by
+// returning the value of its last expression, or null
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral) error {
+	c.enterScope()
+
+	for _, parameter := range node.Parameters {
+		c.symbolTable.Define(parameter.Value)
+	}
+
+	if err := c.compileBlockValue(node.Body, true); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+
+	if err := c.checkLocals(); err != nil {
+		return err
+	}
+	freeSymbols := c.symbolTable.FreeSymbols
+	if len(freeSymbols) > MaxLocals {
+		return fmt.Errorf("function captures more than %d variables", MaxLocals)
+	}
+
+	freeNames := make([]string, len(freeSymbols))
+	for i, symbol := range freeSymbols {
+		freeNames[i] = symbol.Name
+	}
+
+	localNames := c.symbolTable.localNames
+	instructions := c.leaveScope()
+
+	for _, symbol := range freeSymbols {
+		if symbol.Scope == LocalScope {
+			c.emit(code.OpCaptureLocal, symbol.Index)
+		} else {
+			c.emit(code.OpCaptureFree, symbol.Index)
+		}
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     len(localNames),
+		NumParameters: len(node.Parameters),
+		LocalNames:    localNames,
+		FreeNames:     freeNames,
+	}
+	c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+	return nil
+}
+
+// a name that is not bound anywhere yet is taken to be a global that a later
+// let will define, as a function may refer to a global defined after it.
+// Reading it before then is an error in the vm
+func (c *Compiler) resolve(name string) Symbol {
+	if symbol, ok := c.symbolTable.Resolve(name); ok {
+		return symbol
+	}
+	return c.symbolTable.global().Define(name)
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	}
+}
+
+// assign is set for an assignment, which unlike let needs the variable to
+// exist already
+func (c *Compiler) storeSymbol(s Symbol, assign bool) {
+	switch s.Scope {
+	case GlobalScope:
+		if assign {
+			c.emit(code.OpAssignGlobal, s.Index)
+		} else {
+			c.emit(code.OpSetGlobal, s.Index)
+		}
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpSetFree, s.Index)
+	}
+}
+
+func (c *Compiler) checkLocals() error {
+	if len(c.symbolTable.frame().localNames) > MaxLocals {
+		return fmt.Errorf("more than %d local variables in one function", MaxLocals)
+	}
+	return nil
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// returns the position of the emitted instruction
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := c.make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+// encodes an instruction, noting the first operand too large for its width
+func (c *Compiler) make(op code.Opcode, operands ...int) []byte {
+	def, _ := code.Lookup(byte(op))
+	for i, operand := range operands {
+		if c.err == nil && !code.Fits(def.OperandWidths[i], operand) {
+			c.err = operandError(op, def, i, operand)
+		}
+	}
+	return code.Make(op, operands...)
+}
+
+// describes an operand that does not fit by what the program has too many of
+func operandError(op code.Opcode, def *code.Definition, i int, operand int) error {
+	if i == 0 {
+		switch op {
+		case code.OpConstant:
+			return fmt.Errorf("more than %d constants", math.MaxUint16+1)
+		case code.OpGetGlobal, code.OpSetGlobal, code.OpAssignGlobal:
+			return fmt.Errorf("more than %d global variables", math.MaxUint16+1)
+		case code.OpJump, code.OpJumpNotTruthy, code.OpIterNext:
+			return fmt.Errorf("program too large, cannot jump to instruction %d past %d", operand, math.MaxUint16)
+		case code.OpCall, code.OpTailCall:
+			return fmt.Errorf("more than %d arguments in one call", math.MaxUint8)
+		case code.OpArray:
+			return fmt.Errorf("more than %d elements in an array literal", math.MaxUint16)
+		case code.OpHash:
+			return fmt.Errorf("more than %d pairs in a hash literal", math.MaxUint16/2)
+		}
+	}
+	return fmt.Errorf("operand %d of %s does not fit in %d bytes", operand, def.Name, def.OperandWidths[i])
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	return posNewInstruction
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	c.scopes[c.scopeIndex].instructions = c.currentInstructions()[:last.Position]
+	c.scopes[c.scopeIndex].lastInstruction = previous
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+	copy(ins[pos:], newInstruction)
+}
+
+// points the jump at pos somewhere else, or fills in another operand of
+// the same width
+func (c *Compiler) changeOperand(pos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[pos])
+	def, _ := code.Lookup(byte(op))
+
+	operands, _ := code.ReadOperands(def, c.currentInstructions()[pos+1:])
+	operands[0] = operand
+	c.replaceInstruction(pos, c.make(op, operands...))
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{})
+	c.scopeIndex++
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
@@ -0,0 +1,129 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	BuiltinScope SymbolScope = "BUILTIN"
+	FreeScope    SymbolScope = "FREE"
+)
+
+// where a variable lives at run time. Index is its slot in the globals, in
+// the frame's locals, in the builtins or in the closure's free variables,
+// depending on Scope
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// maps names to symbols. There is one table for the top level, one for each
+// function, and one for each loop that scopes its own variables. A loop's
+// variables are locals of the frame the loop runs in, which for a loop at
+// the top level is the frame of the program itself
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store      map[string]Symbol
+	block      bool
+	numGlobals int
+
+	// the names of the globals, or of the local slots of the frame this
+	// table allocates for, by index
+	globalNames []string
+	localNames  []string
+
+	// the symbols in enclosing functions that this function captured, in the
+	// order of its free variable indexes
+	FreeSymbols []Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol)}
+}
+
+// a table for the body of a function defined inside outer
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// a table for a loop inside outer, whose variables share the frame of outer
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewEnclosedSymbolTable(outer)
+	s.block = true
+	return s
+}
+
+// binds name in this table. Defining a name this table already binds reuses
+// its slot, just as a second let in the same environment replaces the
+// binding there
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+		return symbol
+	}
+
+	var symbol Symbol
+	if s.Outer == nil {
+		symbol = Symbol{Name: name, Scope: GlobalScope, Index: s.numGlobals}
+		s.globalNames = append(s.globalNames, name)
+		s.numGlobals++
+	} else {
+		frame := s.frame()
+		symbol = Symbol{Name: name, Scope: LocalScope, Index: len(frame.localNames)}
+		frame.localNames = append(frame.localNames, name)
+	}
+
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Scope: BuiltinScope, Index: index}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Scope: FreeScope, Index: len(s.FreeSymbols) - 1}
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+// looks name up here and then in the enclosing tables. A local of an
+// enclosing function becomes a free variable of every function in between,
+// so that each of them captures it when its closure is created
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+
+	symbol, ok = s.Outer.Resolve(name)
+	if !ok || s.block || symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+		return symbol, ok
+	}
+
+	return s.defineFree(symbol), true
+}
+
+// the table of the function, or of the top level, whose frame holds the
+// locals this table defines
+func (s *SymbolTable) frame() *SymbolTable {
+	for s.block {
+		s = s.Outer
+	}
+	return s
+}
+
+// the table of the top level, where globals are defined
+func (s *SymbolTable) global() *SymbolTable {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	return s
+}
@@ -0,0 +1,90 @@
+package compiler
+
+import "testing"
+
+func TestDefineAndResolve(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+	if again := global.Define("a"); again != a {
+		t.Errorf("redefining a moved it. want=%+v, got=%+v", a, again)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	b := local.Define("b")
+	loop := NewBlockSymbolTable(local)
+	c := loop.Define("c")
+	shadow := loop.Define("b")
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0},
+		{Name: "b", Scope: LocalScope, Index: 0},
+		{Name: "c", Scope: LocalScope, Index: 1},
+		{Name: "b", Scope: LocalScope, Index: 2},
+	}
+	for i, symbol := range []Symbol{a, b, c, shadow} {
+		if symbol != expected[i] {
+			t.Errorf("expected %+v. got=%+v", expected[i], symbol)
+		}
+	}
+
+	if resolved, _ := loop.Resolve("a"); resolved != a {
+		t.Errorf("a resolved to %+v", resolved)
+	}
+	if resolved, _ := local.Resolve("b"); resolved != b {
+		t.Errorf("b outside the loop resolved to %+v", resolved)
+	}
+	if len(local.localNames) != 3 {
+		t.Errorf("loop variables are not locals of the function. got=%v", local.localNames)
+	}
+}
+
+func TestResolveFree(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	first := NewEnclosedSymbolTable(global)
+	first.Define("b")
+	loop := NewBlockSymbolTable(first)
+	loop.Define("c")
+
+	second := NewEnclosedSymbolTable(loop)
+	second.Define("d")
+
+	tests := []struct {
+		name     string
+		expected Symbol
+	}{
+		{"a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{"b", Symbol{Name: "b", Scope: FreeScope, Index: 0}},
+		{"c", Symbol{Name: "c", Scope: FreeScope, Index: 1}},
+		{"d", Symbol{Name: "d", Scope: LocalScope, Index: 0}},
+	}
+
+	for _, tt := range tests {
+		result, ok := second.Resolve(tt.name)
+		if !ok {
+			t.Errorf("name %s not resolvable", tt.name)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", tt.name, tt.expected, result)
+		}
+	}
+
+	expectedFree := []Symbol{
+		{Name: "b", Scope: LocalScope, Index: 0},
+		{Name: "c", Scope: LocalScope, Index: 1},
+	}
+	if len(second.FreeSymbols) != len(expectedFree) {
+		t.Fatalf("wrong number of free symbols. got=%d", len(second.FreeSymbols))
+	}
+	for i, symbol := range expectedFree {
+		if second.FreeSymbols[i] != symbol {
+			t.Errorf("wrong free symbol. want=%+v, got=%+v", symbol, second.FreeSymbols[i])
+		}
+	}
+
+	if _, ok := second.Resolve("e"); ok {
+		t.Errorf("e resolved but was never defined")
+	}
+}
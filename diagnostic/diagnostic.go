@@ -0,0 +1,98 @@
+package diagnostic
+
+import (
+	"fmt"
+
+	"github.com/gavwyh/go-interpreter/token"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+var severityNames = map[Severity]string{
+	Error:   "error",
+	Warning: "warning",
+	Note:    "note",
+}
+
+func (s Severity) String() string {
+	if name, ok := severityNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Severity) UnmarshalText(text []byte) error {
+	for severity, name := range severityNames {
+		if name == string(text) {
+			*s = severity
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown severity %q", text)
+}
+
+// the source range a diagnostic points at. End is exclusive
+type Span struct {
+	Start token.Position `json:"start"`
+	End   token.Position `json:"end"`
+}
+
+func SpanOf(tok token.Token) Span {
+	return Span{Start: tok.Pos, End: tok.End}
+}
+
+// a suggested edit: replace the source covered by Span with Replacement.
+// An empty span (Start == End) is an insertion
+type Fix struct {
+	Message     string `json:"message"`
+	Span        Span   `json:"span"`
+	Replacement string `json:"replacement"`
+}
+
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+	Span     Span     `json:"span"`
+	Notes    []string `json:"notes,omitempty"`
+	Fixes    []Fix    `json:"fixes,omitempty"`
+}
+
+func New(severity Severity, code string, span Span, format string, a ...interface{}) Diagnostic {
+	return Diagnostic{
+		Severity: severity,
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+		Span:     span,
+	}
+}
+
+func Errorf(code string, span Span, format string, a ...interface{}) Diagnostic {
+	return New(Error, code, span, format, a...)
+}
+
+// formats as "file:line:column: error[CODE]: message", which is what most
+// editors expect from a compiler
+func (d Diagnostic) Error() string {
+	return fmt.Sprintf("%s: %s[%s]: %s", d.Span.Start, d.Severity, d.Code, d.Message)
+}
+
+func (d Diagnostic) WithNote(format string, a ...interface{}) Diagnostic {
+	d.Notes = append(d.Notes[:len(d.Notes):len(d.Notes)], fmt.Sprintf(format, a...))
+	return d
+}
+
+func (d Diagnostic) WithFix(fix Fix) Diagnostic {
+	d.Fixes = append(d.Fixes[:len(d.Fixes):len(d.Fixes)], fix)
+	return d
+}
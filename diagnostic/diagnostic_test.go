@@ -0,0 +1,88 @@
+package diagnostic
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/gavwyh/go-interpreter/token"
+)
+
+func TestFormat(t *testing.T) {
+	source := "let x = 1;\nadd(1, 2\n"
+	insertAt := token.Position{Filename: "main.mk", Offset: 19, Line: 2, Column: 9}
+
+	d := Errorf("P0001", Span{Start: insertAt, End: insertAt},
+		"expected next token to be ), got=EOF").
+		WithNote("calls are closed with `)`").
+		WithFix(Fix{Message: "insert `)`", Span: Span{Start: insertAt, End: insertAt}, Replacement: ")"})
+
+	expected := "error[P0001]: expected next token to be ), got=EOF\n" +
+		" --> main.mk:2:9\n" +
+		"  |\n" +
+		"2 | add(1, 2\n" +
+		"  |         ^\n" +
+		"  = note: calls are closed with `)`\n" +
+		"  = help: insert `)`\n"
+
+	if actual := Format(source, d); actual != expected {
+		t.Errorf("wrong rendering.\nexpected=\n%s\ngot=\n%s", expected, actual)
+	}
+}
+
+func TestFormatUnderlinesSpan(t *testing.T) {
+	source := "\tlet x = 99999999999999999999;"
+	start := token.Position{Offset: 9, Line: 1, Column: 10}
+	end := token.Position{Offset: 29, Line: 1, Column: 30}
+
+	d := Errorf("P0003", Span{Start: start, End: end}, "too big")
+
+	expected := "error[P0003]: too big\n" +
+		" --> 1:10\n" +
+		"  |\n" +
+		"1 | \tlet x = 99999999999999999999;\n" +
+		"  | \t        ^^^^^^^^^^^^^^^^^^^^\n"
+
+	if actual := Format(source, d); actual != expected {
+		t.Errorf("wrong rendering.\nexpected=\n%s\ngot=\n%s", expected, actual)
+	}
+}
+
+func TestFormatWithoutPosition(t *testing.T) {
+	d := New(Warning, "W0001", Span{}, "something odd")
+
+	if actual := Format("", d); actual != "warning[W0001]: something odd\n" {
+		t.Errorf("wrong rendering. got=%q", actual)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	pos := token.Position{Offset: 4, Line: 1, Column: 5}
+	diagnostics := []Diagnostic{
+		Errorf("P0002", Span{Start: pos, End: pos}, "no prefix parse function for ; found").
+			WithNote("a note"),
+	}
+
+	var out bytes.Buffer
+	if err := WriteJSON(&out, diagnostics); err != nil {
+		t.Fatalf("WriteJSON returned error: %s", err)
+	}
+
+	var decoded []Diagnostic
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("output is not valid JSON: %s\n%s", err, out.String())
+	}
+
+	if len(decoded) != 1 {
+		t.Fatalf("wrong number of diagnostics. got=%d", len(decoded))
+	}
+
+	if decoded[0].Severity != Error || decoded[0].Code != "P0002" ||
+		decoded[0].Span.Start != pos || len(decoded[0].Notes) != 1 {
+		t.Errorf("diagnostic did not round trip. got=%+v", decoded[0])
+	}
+
+	if !bytes.Contains(out.Bytes(), []byte(`"severity": "error"`)) {
+		t.Errorf("severity not written as text. got=%s", out.String())
+	}
+}
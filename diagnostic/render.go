@@ -0,0 +1,121 @@
+package diagnostic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// prints every diagnostic rustc-style, quoting the offending line of source
+// and underlining the span with carets:
+//
+//	error[P0001]: expected next token to be ), got=EOF
+//	 --> main.mk:1:9
+//	  |
+//	1 | add(1, 2
+//	  |         ^
+//	  = help: insert `)`
+func Render(w io.Writer, source string, diagnostics []Diagnostic) error {
+	for _, d := range diagnostics {
+		if _, err := io.WriteString(w, Format(source, d)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Format(source string, d Diagnostic) string {
+	var out strings.Builder
+
+	fmt.Fprintf(&out, "%s[%s]: %s\n", d.Severity, d.Code, d.Message)
+
+	start := d.Span.Start
+	if !start.IsValid() {
+		writeTrailers(&out, "", d)
+		return out.String()
+	}
+
+	gutter := strings.Repeat(" ", len(strconv.Itoa(start.Line)))
+	fmt.Fprintf(&out, "%s--> %s\n", gutter, start)
+
+	line, lineStart, ok := sourceLine(source, start.Offset)
+	if ok {
+		fmt.Fprintf(&out, "%s |\n", gutter)
+		fmt.Fprintf(&out, "%d | %s\n", start.Line, line)
+		fmt.Fprintf(&out, "%s | %s\n", gutter, underline(line, start.Offset-lineStart, d.Span.End.Offset-lineStart))
+	}
+
+	writeTrailers(&out, gutter, d)
+	return out.String()
+}
+
+// writes diagnostics as a JSON array, for tools rather than people
+func WriteJSON(w io.Writer, diagnostics []Diagnostic) error {
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(diagnostics)
+}
+
+func writeTrailers(out *strings.Builder, gutter string, d Diagnostic) {
+	for _, note := range d.Notes {
+		fmt.Fprintf(out, "%s = note: %s\n", gutter, note)
+	}
+	for _, fix := range d.Fixes {
+		fmt.Fprintf(out, "%s = help: %s\n", gutter, fix.Message)
+	}
+}
+
+// returns the line containing offset (without its newline) along with the
+// offset the line starts at
+func sourceLine(source string, offset int) (string, int, bool) {
+	if offset < 0 || offset > len(source) {
+		return "", 0, false
+	}
+
+	lineStart := strings.LastIndexByte(source[:offset], '\n') + 1
+	lineEnd := strings.IndexByte(source[offset:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(source)
+	} else {
+		lineEnd += offset
+	}
+
+	return strings.TrimSuffix(source[lineStart:lineEnd], "\r"), lineStart, true
+}
+
+// pads up to from with blanks (keeping tabs so the carets line up with the
+// quoted line) and puts a caret under every character up to to. Spans that
+// run past the end of the line are cut off there, and an empty span still
+// gets a single caret
+func underline(line string, from, to int) string {
+	if from > len(line) {
+		from = len(line)
+	}
+	if to > len(line) {
+		to = len(line)
+	}
+
+	var out strings.Builder
+
+	for _, ch := range line[:from] {
+		if ch == '\t' {
+			out.WriteRune('\t')
+		} else {
+			out.WriteRune(' ')
+		}
+	}
+
+	width := 1
+	if to > from {
+		width = utf8.RuneCountInString(line[from:to])
+	}
+	out.WriteString(strings.Repeat("^", width))
+
+	return out.String()
+}
@@ -0,0 +1,61 @@
+package evaluator
+
+import (
+	"unicode/utf8"
+
+	"github.com/gavwyh/go-interpreter/object"
+)
+
+// functions available everywhere unless a variable of the same name hides
+// them. Compiled code refers to a builtin by its position in this list, so
+// new ones go at the end
+var Builtins = []*object.Builtin{
+	{Name: "len", Fn: builtinLen},
+	{Name: "push", Fn: builtinPush},
+}
+
+// returns the builtin called name, or nil if there is none
+func LookupBuiltin(name string) *object.Builtin {
+	for _, builtin := range Builtins {
+		if builtin.Name == name {
+			return builtin
+		}
+	}
+	return nil
+}
+
+// the number of elements a for-in loop would visit, so strings are measured
+// in runes
+func builtinLen(arguments ...object.Object) object.Object {
+	if len(arguments) != 1 {
+		return newError("wrong number of arguments: want=1, got=%d", len(arguments))
+	}
+
+	switch argument := arguments[0].(type) {
+	case *object.String:
+		return &object.Integer{Value: int64(utf8.RuneCountInString(argument.Value))}
+	case *object.Array:
+		return &object.Integer{Value: int64(len(argument.Elements))}
+	case *object.Hash:
+		return &object.Integer{Value: int64(argument.Len())}
+	default:
+		return newError("argument to `len` not supported, got %s", argument.Type())
+	}
+}
+
+// returns a new array with the element added to the end, leaving the
+// original untouched
+func builtinPush(arguments ...object.Object) object.Object {
+	if len(arguments) != 2 {
+		return newError("wrong number of arguments: want=2, got=%d", len(arguments))
+	}
+
+	array, ok := arguments[0].(*object.Array)
+	if !ok {
+		return newError("first argument to `push` must be ARRAY, got %s", arguments[0].Type())
+	}
+
+	elements := make([]object.Object, len(array.Elements), len(array.Elements)+1)
+	copy(elements, array.Elements)
+	return &object.Array{Elements: append(elements, arguments[1])}
+}
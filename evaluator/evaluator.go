@@ -0,0 +1,1054 @@
+package evaluator
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/gavwyh/go-interpreter/ast"
+	"github.com/gavwyh/go-interpreter/object"
+)
+
+// there is only ever one null, true and false so they are shared instead of
+// allocating a new object for every evaluation. The same goes for break and
+// continue, which carry no value
+var (
+	NULL     = &object.Null{}
+	TRUE     = &object.Boolean{Value: true}
+	FALSE    = &object.Boolean{Value: false}
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
+)
+
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+
+	// statements
+	case *ast.Program:
+		return evalProgram(node, env)
+	case *ast.ExpressionStatement:
+		return Eval(node.Expression, env)
+	case *ast.BlockStatement:
+		return evalBlockStatement(node, env)
+	case *ast.LetStatement:
+		return evalLetStatement(node, env)
+	case *ast.ReturnStatement:
+		return evalReturnStatement(node, env)
+	case *ast.BadStatement:
+		return newError("cannot evaluate bad statement at %s", node.Pos())
+
+	// expressions
+	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return &object.BigInt{Value: node.Big}
+		}
+		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+	case *ast.Boolean:
+		return nativeBoolToBooleanObject(node.Value)
+	case *ast.Identifier:
+		return evalIdentifier(node, env)
+	case *ast.PrefixExpression:
+		right := Eval(node.Right, env)
+		if isAbrupt(right) {
+			return right
+		}
+		return evalPrefixExpression(node.Operator, right)
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, env)
+		}
+		left := Eval(node.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+		right := Eval(node.Right, env)
+		if isAbrupt(right) {
+			return right
+		}
+		return evalInfixExpression(node.Operator, left, right)
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
+	case *ast.IfExpression:
+		return evalIfExpression(node, env)
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+	case *ast.ForInStatement:
+		return evalForInStatement(node, env)
+	case *ast.RangeExpression:
+		return evalRangeExpression(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
+	case *ast.FunctionLiteral:
+		return &object.Function{Parameters: node.Parameters, Body: node.Body, Env: env}
+	case *ast.ArrayLiteral:
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isAbrupt(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+	case *ast.HashLiteral:
+		return evalHashLiteral(node, env)
+	case *ast.IndexExpression:
+		left := Eval(node.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+		index := Eval(node.Index, env)
+		if isAbrupt(index) {
+			return index
+		}
+		return evalIndexExpression(left, index)
+	case *ast.BadExpression:
+		return newError("cannot evaluate bad expression at %s", node.Pos())
+	case *ast.CallExpression:
+		call := evalTailCall(node, env)
+		if tailCall, ok := call.(*object.TailCall); ok {
+			return applyFunction(tailCall.Function, tailCall.Arguments)
+		}
+		return call
+	}
+
+	return nil
+}
+
+func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, statement := range program.Statements {
+		result = Eval(statement, env)
+
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			// a return outside of any function has nobody to make its tail
+			// call, so it is made here
+			if tailCall, ok := result.Value.(*object.TailCall); ok {
+				return applyFunction(tailCall.Function, tailCall.Arguments)
+			}
+			return result.Value
+		case *object.Error:
+			return result
+		case *object.Break, *object.Continue:
+			return newError("%s is not inside a loop", result.Inspect())
+		}
+	}
+
+	return result
+}
+
+// unlike evalProgram the return value is not unwrapped, so that an outer
+// block (or the program) can stop evaluating as well
+func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, statement := range block.Statements {
+		result = Eval(statement, env)
+
+		if result != nil {
+			resultType := result.Type()
+			switch resultType {
+			case object.RETURN_VALUE_OBJ, object.ERROR_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+				return result
+			}
+		}
+	}
+
+	// an empty block, or one ending in a statement such as let, is null like
+	// an if without an else
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+func evalLetStatement(statement *ast.LetStatement, env *object.Environment) object.Object {
+	var value object.Object = NULL
+
+	if statement.Value != nil {
+		value = Eval(statement.Value, env)
+		if isAbrupt(value) {
+			return value
+		}
+	}
+
+	env.Define(statement.Name.Value, value)
+	return nil
+}
+
+func evalReturnStatement(statement *ast.ReturnStatement, env *object.Environment) object.Object {
+	var value object.Object = NULL
+
+	if statement.ReturnValue != nil {
+		value = evalTailExpression(statement.ReturnValue, env)
+		if isAbrupt(value) {
+			return value
+		}
+	}
+
+	return &object.ReturnValue{Value: value}
+}
+
+// like evalBlockStatement, for a block whose value becomes the result of the
+// function call it is in, such as the body of the function. Its last
+// expression is in tail position
+func evalTailBlock(block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object
+
+	for i, statement := range block.Statements {
+		if expression, ok := statement.(*ast.ExpressionStatement); ok && i == len(block.Statements)-1 {
+			return evalTailExpression(expression.Expression, env)
+		}
+
+		result = Eval(statement, env)
+
+		if result != nil {
+			switch result.Type() {
+			case object.RETURN_VALUE_OBJ, object.ERROR_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+				return result
+			}
+		}
+	}
+
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+// evaluates an expression in tail position, where a call is returned as a
+// TailCall rather than made. An if in tail position passes that on to the
+// last expression of whichever branch it takes
+func evalTailExpression(expression ast.Expression, env *object.Environment) object.Object {
+	switch expression := expression.(type) {
+	case *ast.CallExpression:
+		return evalTailCall(expression, env)
+	case *ast.IfExpression:
+		branch, condition := chooseBranch(expression, env)
+		if isAbrupt(condition) {
+			return condition
+		}
+		if branch == nil {
+			return NULL
+		}
+		return evalTailBlock(branch, env)
+	default:
+		return Eval(expression, env)
+	}
+}
+
+// evaluates the function and arguments of a call without making it
+func evalTailCall(call *ast.CallExpression, env *object.Environment) object.Object {
+	function := Eval(call.Function, env)
+	if isAbrupt(function) {
+		return function
+	}
+
+	arguments := evalExpressions(call.Arguments, env)
+	if len(arguments) == 1 && isAbrupt(arguments[0]) {
+		return arguments[0]
+	}
+
+	return &object.TailCall{Function: function, Arguments: arguments}
+}
+
+// evaluates left to right, stopping at the first error or other abrupt
+// result, which is returned on its own
+func evalExpressions(expressions []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+
+	for _, expression := range expressions {
+		evaluated := Eval(expression, env)
+		if isAbrupt(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+// a call the body ends with is made by going round the loop again instead of
+// recursing, so a chain of tail calls runs in constant Go stack
+func applyFunction(fn object.Object, arguments []object.Object) object.Object {
+	for {
+		if builtin, ok := fn.(*object.Builtin); ok {
+			return builtin.Fn(arguments...)
+		}
+
+		function, ok := fn.(*object.Function)
+		if !ok {
+			return newError("not a function: %s", fn.Type())
+		}
+
+		if len(arguments) != len(function.Parameters) {
+			return newError("wrong number of arguments: want=%d, got=%d",
+				len(function.Parameters), len(arguments))
+		}
+
+		extendedEnv := extendFunctionEnv(function, arguments)
+		evaluated := unwrapReturnValue(evalTailBlock(function.Body, extendedEnv))
+
+		tailCall, ok := evaluated.(*object.TailCall)
+		if !ok {
+			return evaluated
+		}
+		fn, arguments = tailCall.Function, tailCall.Arguments
+	}
+}
+
+func extendFunctionEnv(function *object.Function, arguments []object.Object) *object.Environment {
+	env := object.NewEnclosedEnvironment(function.Env)
+
+	for i, parameter := range function.Parameters {
+		env.Define(parameter.Value, arguments[i])
+	}
+
+	return env
+}
+
+// stops a return inside the function body from also returning from the caller
+func unwrapReturnValue(obj object.Object) object.Object {
+	if returnValue, ok := obj.(*object.ReturnValue); ok {
+		return returnValue.Value
+	}
+
+	// an empty body evaluates to nothing, which a caller sees as null
+	if obj == nil {
+		return NULL
+	}
+
+	if obj == BREAK || obj == CONTINUE {
+		return newError("%s is not inside a loop", obj.Inspect())
+	}
+
+	return obj
+}
+
+// loops are statements and evaluate to null, unless a return or an error
+// in the body ends them early
+func evalWhileStatement(node *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(node.Condition, env)
+		if isAbrupt(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		if result, done := loopBodyResult(Eval(node.Body, env)); done {
+			return result
+		}
+	}
+}
+
+// the init clause runs in an environment of its own, so a variable it
+// declares is not visible after the loop
+func evalForStatement(node *ast.ForStatement, env *object.Environment) object.Object {
+	loopEnv := object.NewEnclosedEnvironment(env)
+
+	if node.Init != nil {
+		if init := Eval(node.Init, loopEnv); isAbrupt(init) {
+			return init
+		}
+	}
+
+	for {
+		if node.Condition != nil {
+			condition := Eval(node.Condition, loopEnv)
+			if isAbrupt(condition) {
+				return condition
+			}
+			if !isTruthy(condition) {
+				return NULL
+			}
+		}
+
+		if result, done := loopBodyResult(Eval(node.Body, loopEnv)); done {
+			return result
+		}
+
+		if node.Step != nil {
+			if step := Eval(node.Step, loopEnv); isAbrupt(step) {
+				return step
+			}
+		}
+	}
+}
+
+// each pass gets a fresh environment for the loop variables, so a closure
+// created in the body keeps the values from its own pass. With one variable
+// the loop binds the element, which for a hash is its key
+func evalForInStatement(node *ast.ForInStatement, env *object.Environment) object.Object {
+	value := Eval(node.Iterable, env)
+	if isAbrupt(value) {
+		return value
+	}
+
+	iterable, ok := value.(object.Iterable)
+	if !ok {
+		return newError("not iterable: %s", value.Type())
+	}
+
+	iterator := iterable.Iterate()
+	for {
+		key, element, ok := iterator.Next()
+		if !ok {
+			return NULL
+		}
+
+		passEnv := object.NewEnclosedEnvironment(env)
+		if node.Key != nil {
+			passEnv.Define(node.Key.Value, key)
+			passEnv.Define(node.Value.Value, element)
+		} else {
+			passEnv.Define(node.Value.Value, loopElement(iterable, key, element))
+		}
+
+		if result, done := loopBodyResult(Eval(node.Body, passEnv)); done {
+			return result
+		}
+	}
+}
+
+func evalRangeExpression(node *ast.RangeExpression, env *object.Environment) object.Object {
+	from := Eval(node.From, env)
+	if isAbrupt(from) {
+		return from
+	}
+
+	to := Eval(node.To, env)
+	if isAbrupt(to) {
+		return to
+	}
+
+	return makeRange(from, to, node.Inclusive)
+}
+
+func makeRange(from, to object.Object, inclusive bool) object.Object {
+	fromInteger, fromOk := from.(*object.Integer)
+	toInteger, toOk := to.(*object.Integer)
+	if !fromOk || !toOk {
+		operator := ".."
+		if inclusive {
+			operator = "..="
+		}
+		return newError("range bounds must be INTEGER, got %s%s%s", from.Type(), operator, to.Type())
+	}
+
+	return &object.Range{From: fromInteger.Value, To: toInteger.Value, Inclusive: inclusive}
+}
+
+// what a for-in loop with a single variable binds on each pass
+func loopElement(iterable object.Iterable, key, element object.Object) object.Object {
+	if _, isHash := iterable.(*object.Hash); isHash {
+		return key
+	}
+	return element
+}
+
+// decides whether a loop stops after its body evaluated to result, and what
+// it then evaluates to. break stops it with null, a return or an error
+// stops it and is passed on, anything else including continue carries on
+func loopBodyResult(result object.Object) (object.Object, bool) {
+	if result == nil {
+		return nil, false
+	}
+
+	switch result.Type() {
+	case object.BREAK_OBJ:
+		return NULL, true
+	case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+		return result, true
+	}
+	return nil, false
+}
+
+func evalIdentifier(identifier *ast.Identifier, env *object.Environment) object.Object {
+	if value, ok := env.Get(identifier.Value); ok {
+		return value
+	}
+
+	if builtin := LookupBuiltin(identifier.Value); builtin != nil {
+		return builtin
+	}
+
+	return newError("identifier not found: %s", identifier.Value)
+}
+
+func evalPrefixExpression(operator string, right object.Object) object.Object {
+	switch operator {
+	case "!":
+		return evalBangOperatorExpression(right)
+	case "-":
+		return evalMinusPrefixOperatorExpression(right)
+	case "~":
+		return evalComplementPrefixOperatorExpression(right)
+	default:
+		return newError("unknown operator: %s%s", operator, right.Type())
+	}
+}
+
+func evalBangOperatorExpression(right object.Object) object.Object {
+	return nativeBoolToBooleanObject(!isTruthy(right))
+}
+
+func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		if right.Value == math.MinInt64 {
+			return object.NewInteger(new(big.Int).Neg(big.NewInt(right.Value)))
+		}
+		return &object.Integer{Value: -right.Value}
+	case *object.BigInt:
+		return object.NewInteger(new(big.Int).Neg(right.Value))
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
+		return newError("unknown operator: -%s", right.Type())
+	}
+}
+
+func evalInfixExpression(operator string, left, right object.Object) object.Object {
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return evalIntegerInfixExpression(operator, left, right)
+	case isInteger(left) && isInteger(right):
+		return evalBigIntInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right)
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	// booleans and null are singletons, so pointer comparison is enough
+	case operator == "==":
+		return nativeBoolToBooleanObject(left == right)
+	case operator == "!=":
+		return nativeBoolToBooleanObject(left != right)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// && and || only evaluate their right operand when the left one does not
+// already decide the result. Both always produce a boolean
+func evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isAbrupt(left) {
+		return left
+	}
+
+	if node.Operator == "&&" && !isTruthy(left) {
+		return FALSE
+	}
+	if node.Operator == "||" && isTruthy(left) {
+		return TRUE
+	}
+
+	right := Eval(node.Right, env)
+	if isAbrupt(right) {
+		return right
+	}
+
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
+func evalComplementPrefixOperatorExpression(right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: ^right.Value}
+	case *object.BigInt:
+		return object.NewInteger(new(big.Int).Not(right.Value))
+	default:
+		return newError("unknown operator: ~%s", right.Type())
+	}
+}
+
+// the most bits << shifts by. The result is allocated in full, and a
+// larger count could exhaust memory, which is fatal rather than recoverable
+const MaxShift = 1 << 22
+
+// shifts by a negative count are an error rather than silently shifting the
+// other way. << never loses bits, it overflows into a BigInt instead, while
+// >> by 64 or more gives 0 or -1 depending on the sign
+func evalShiftExpression(operator string, left, right int64) object.Object {
+	if right < 0 {
+		return newError("negative shift count: %d %s %d", left, operator, right)
+	}
+	if operator == "<<" && right > MaxShift {
+		return newError("shift count too large: %d %s %d", left, operator, right)
+	}
+	if operator == ">>" {
+		return &object.Integer{Value: left >> uint64(right)}
+	}
+	if right < 63 && left<<uint64(right)>>uint64(right) == left {
+		return &object.Integer{Value: left << uint64(right)}
+	}
+	return object.NewInteger(new(big.Int).Lsh(big.NewInt(left), uint(right)))
+}
+
+func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+	leftValue := left.(*object.Integer).Value
+	rightValue := right.(*object.Integer).Value
+
+	// +, -, * and / check for overflow and redo the operation with BigInts
+	// when it happens, instead of wrapping around
+	switch operator {
+	case "+":
+		if sum := leftValue + rightValue; (sum > leftValue) == (rightValue > 0) {
+			return &object.Integer{Value: sum}
+		}
+		return evalBigIntInfixExpression(operator, left, right)
+	case "-":
+		if difference := leftValue - rightValue; (difference < leftValue) == (rightValue > 0) {
+			return &object.Integer{Value: difference}
+		}
+		return evalBigIntInfixExpression(operator, left, right)
+	case "*":
+		product := leftValue * rightValue
+		overflow := leftValue != 0 && (product/leftValue != rightValue || leftValue == -1 && rightValue == math.MinInt64)
+		if !overflow {
+			return &object.Integer{Value: product}
+		}
+		return evalBigIntInfixExpression(operator, left, right)
+	case "/":
+		if rightValue == 0 {
+			return newError("division by zero: %d / %d", leftValue, rightValue)
+		}
+		if leftValue == math.MinInt64 && rightValue == -1 {
+			return evalBigIntInfixExpression(operator, left, right)
+		}
+		return &object.Integer{Value: leftValue / rightValue}
+	case "%":
+		if rightValue == 0 {
+			return newError("division by zero: %d %% %d", leftValue, rightValue)
+		}
+		return &object.Integer{Value: leftValue % rightValue}
+	case "&":
+		return &object.Integer{Value: leftValue & rightValue}
+	case "|":
+		return &object.Integer{Value: leftValue | rightValue}
+	case "^":
+		return &object.Integer{Value: leftValue ^ rightValue}
+	case "<<", ">>":
+		return evalShiftExpression(operator, leftValue, rightValue)
+	case "<":
+		return nativeBoolToBooleanObject(leftValue < rightValue)
+	case ">":
+		return nativeBoolToBooleanObject(leftValue > rightValue)
+	case "<=":
+		return nativeBoolToBooleanObject(leftValue <= rightValue)
+	case ">=":
+		return nativeBoolToBooleanObject(leftValue >= rightValue)
+	case "==":
+		return nativeBoolToBooleanObject(leftValue == rightValue)
+	case "!=":
+		return nativeBoolToBooleanObject(leftValue != rightValue)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// used when either side is a BigInt, and by evalIntegerInfixExpression when
+// an operation overflows. Results that fit in an int64 become an Integer
+// again. / and % truncate towards zero like they do for Integers
+func evalBigIntInfixExpression(operator string, left, right object.Object) object.Object {
+	leftValue := toBigInt(left)
+	rightValue := toBigInt(right)
+	result := new(big.Int)
+
+	switch operator {
+	case "+":
+		return object.NewInteger(result.Add(leftValue, rightValue))
+	case "-":
+		return object.NewInteger(result.Sub(leftValue, rightValue))
+	case "*":
+		return object.NewInteger(result.Mul(leftValue, rightValue))
+	case "/":
+		if rightValue.Sign() == 0 {
+			return newError("division by zero: %s / %s", leftValue, rightValue)
+		}
+		return object.NewInteger(result.Quo(leftValue, rightValue))
+	case "%":
+		if rightValue.Sign() == 0 {
+			return newError("division by zero: %s %% %s", leftValue, rightValue)
+		}
+		return object.NewInteger(result.Rem(leftValue, rightValue))
+	case "&":
+		return object.NewInteger(result.And(leftValue, rightValue))
+	case "|":
+		return object.NewInteger(result.Or(leftValue, rightValue))
+	case "^":
+		return object.NewInteger(result.Xor(leftValue, rightValue))
+	case "<<", ">>":
+		if rightValue.Sign() < 0 {
+			return newError("negative shift count: %s %s %s", leftValue, operator, rightValue)
+		}
+		if !rightValue.IsInt64() || operator == "<<" && rightValue.Int64() > MaxShift {
+			return newError("shift count too large: %s %s %s", leftValue, operator, rightValue)
+		}
+		if operator == "<<" {
+			return object.NewInteger(result.Lsh(leftValue, uint(rightValue.Int64())))
+		}
+		return object.NewInteger(result.Rsh(leftValue, uint(rightValue.Int64())))
+	case "<":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) < 0)
+	case ">":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) <= 0)
+	case ">=":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) >= 0)
+	case "==":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) != 0)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// used whenever either side is a float, the other side is promoted so that
+// 1 + 2.5 is 3.5. Only integer with integer stays an integer
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftValue := toFloat(left)
+	rightValue := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftValue + rightValue}
+	case "-":
+		return &object.Float{Value: leftValue - rightValue}
+	case "*":
+		return &object.Float{Value: leftValue * rightValue}
+	case "/":
+		if rightValue == 0 {
+			return newError("division by zero: %s / %s", left.Inspect(), right.Inspect())
+		}
+		return &object.Float{Value: leftValue / rightValue}
+	case "%":
+		if rightValue == 0 {
+			return newError("division by zero: %s %% %s", left.Inspect(), right.Inspect())
+		}
+		return &object.Float{Value: math.Mod(leftValue, rightValue)}
+	case "<":
+		return nativeBoolToBooleanObject(leftValue < rightValue)
+	case ">":
+		return nativeBoolToBooleanObject(leftValue > rightValue)
+	case "<=":
+		return nativeBoolToBooleanObject(leftValue <= rightValue)
+	case ">=":
+		return nativeBoolToBooleanObject(leftValue >= rightValue)
+	case "==":
+		return nativeBoolToBooleanObject(leftValue == rightValue)
+	case "!=":
+		return nativeBoolToBooleanObject(leftValue != rightValue)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func isInteger(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.BIGINT_OBJ
+}
+
+func isNumber(obj object.Object) bool {
+	return isInteger(obj) || obj.Type() == object.FLOAT_OBJ
+}
+
+func toBigInt(obj object.Object) *big.Int {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return big.NewInt(obj.Value)
+	case *object.BigInt:
+		return obj.Value
+	default:
+		return new(big.Int)
+	}
+}
+
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.BigInt:
+		value, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return value
+	case *object.Float:
+		return obj.Value
+	default:
+		return 0
+	}
+}
+
+func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftValue + rightValue}
+	case "==":
+		return nativeBoolToBooleanObject(leftValue == rightValue)
+	case "!=":
+		return nativeBoolToBooleanObject(leftValue != rightValue)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalIndexExpression(left, index object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.ARRAY_OBJ:
+		return newError("array index must be INTEGER, got %s", index.Type())
+	case left.Type() == object.HASH_OBJ:
+		return evalHashIndexExpression(left, index)
+	default:
+		return newError("index operator not supported: %s", left.Type())
+	}
+}
+
+// negative indexes count back from the end, so arr[-1] is the last element.
+// Anything out of range evaluates to null
+func evalArrayIndexExpression(array, index object.Object) object.Object {
+	elements := array.(*object.Array).Elements
+	i := index.(*object.Integer).Value
+	length := int64(len(elements))
+
+	if i < 0 {
+		i += length
+	}
+
+	if i < 0 || i >= length {
+		return NULL
+	}
+
+	return elements[i]
+}
+
+// evaluates to the value assigned. For an index target the collection and
+// index are evaluated once, before the value
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		return evalIdentifierAssignment(node, target, env)
+	case *ast.IndexExpression:
+		return evalIndexAssignment(node, target, env)
+	default:
+		return newError("cannot assign to %s", node.Target.String())
+	}
+}
+
+// the variable must already exist, and is updated in the environment that
+// defines it
+func evalIdentifierAssignment(node *ast.AssignExpression, target *ast.Identifier, env *object.Environment) object.Object {
+	current, ok := env.Get(target.Value)
+	if !ok {
+		return newError("identifier not found: %s", target.Value)
+	}
+
+	value := Eval(node.Value, env)
+	if isAbrupt(value) {
+		return value
+	}
+
+	value = assignedValue(node.Operator, current, value)
+	if isAbrupt(value) {
+		return value
+	}
+
+	env.Set(target.Value, value)
+	return value
+}
+
+// arrays and hashes are updated in place, so every variable referring to the
+// same one sees the change. Unlike reading, assigning outside an array's
+// bounds is an error
+func evalIndexAssignment(node *ast.AssignExpression, target *ast.IndexExpression, env *object.Environment) object.Object {
+	left := Eval(target.Left, env)
+	if isAbrupt(left) {
+		return left
+	}
+
+	index := Eval(target.Index, env)
+	if isAbrupt(index) {
+		return index
+	}
+
+	value := Eval(node.Value, env)
+	if isAbrupt(value) {
+		return value
+	}
+
+	return assignIndex(node.Operator, left, index, value)
+}
+
+// stores value at index in left, first combining it with the value already
+// there for a compound operator, and returns what was stored
+func assignIndex(operator string, left, index, value object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		integer, ok := index.(*object.Integer)
+		if !ok {
+			return newError("array index must be INTEGER, got %s", index.Type())
+		}
+
+		i := integer.Value
+		if i < 0 {
+			i += int64(len(left.Elements))
+		}
+		if i < 0 || i >= int64(len(left.Elements)) {
+			return newError("index out of range: %d", integer.Value)
+		}
+
+		value = assignedValue(operator, left.Elements[i], value)
+		if isAbrupt(value) {
+			return value
+		}
+		left.Elements[i] = value
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+
+		if operator != "=" {
+			current, ok := left.Get(key)
+			if !ok {
+				return newError("key not found: %s", index.Inspect())
+			}
+			value = assignedValue(operator, current, value)
+			if isAbrupt(value) {
+				return value
+			}
+		}
+		left.Set(key, value)
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+
+	return value
+}
+
+// the value a target ends up with, so for x += 1 it is x + 1
+func assignedValue(operator string, current, value object.Object) object.Object {
+	if operator == "=" {
+		return value
+	}
+	return evalInfixExpression(strings.TrimSuffix(operator, "="), current, value)
+}
+
+func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
+
+	for _, pair := range node.Pairs {
+		key := Eval(pair.Key, env)
+		if isAbrupt(key) {
+			return key
+		}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+
+		value := Eval(pair.Value, env)
+		if isAbrupt(value) {
+			return value
+		}
+
+		hash.Set(hashKey, value)
+	}
+
+	return hash
+}
+
+// a missing key evaluates to null, like an out of range array index
+func evalHashIndexExpression(hash, index object.Object) object.Object {
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", index.Type())
+	}
+
+	value, ok := hash.(*object.Hash).Get(key)
+	if !ok {
+		return NULL
+	}
+
+	return value
+}
+
+func evalIfExpression(expression *ast.IfExpression, env *object.Environment) object.Object {
+	branch, condition := chooseBranch(expression, env)
+	if isAbrupt(condition) {
+		return condition
+	}
+
+	if branch == nil {
+		return NULL
+	}
+	return Eval(branch, env)
+}
+
+// evaluates the condition and returns the block to run, which is nil when
+// the condition is false and there is no else. The condition is returned so
+// that the caller can check it for an error
+func chooseBranch(expression *ast.IfExpression, env *object.Environment) (*ast.BlockStatement, object.Object) {
+	condition := Eval(expression.Condition, env)
+	if isAbrupt(condition) {
+		return nil, condition
+	}
+
+	if isTruthy(condition) {
+		return expression.Consequence, condition
+	}
+	return expression.Alternative, condition
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
+// only null and false are falsy, everything else (including 0) is truthy
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case NULL:
+		return false
+	case TRUE:
+		return true
+	case FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+// an error, or a return, break or continue on its way out to the function or
+// loop it belongs to. Whatever was being evaluated around it stops and passes
+// it on, so that e.g. the continue in 1 + if (true) { continue } reaches
+// the loop
+func isAbrupt(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Error, *object.ReturnValue, *object.Break, *object.Continue:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,1164 @@
+package evaluator
+
+import (
+	"testing"
+
+	"github.com/gavwyh/go-interpreter/lexer"
+	"github.com/gavwyh/go-interpreter/object"
+	"github.com/gavwyh/go-interpreter/parser"
+)
+
+func TestEvalIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"5", 5},
+		{"10", 10},
+		{"-5", -5},
+		{"-10", -10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"-50 + 100 + -50", 0},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"20 + 2 * -10", 0},
+		{"50 / 2 * 2 + 10", 60},
+		{"2 * (5 + 10)", 30},
+		{"3 * 3 * 3 + 10", 37},
+		{"3 * (3 * 3) + 10", 37},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"10 % 3", 1},
+		{"-7 % 3", -1},
+		{"2 + 10 % 4 * 3", 8},
+		{"12 & 10", 8},
+		{"12 | 10", 14},
+		{"12 ^ 10", 6},
+		{"~0", -1},
+		{"~5", -6},
+		{"1 << 4", 16},
+		{"256 >> 4", 16},
+		{"-16 >> 2", -4},
+		{"-1 >> 64", -1},
+		{"1 << 2 + 1", 8},
+		{"6 & 3 + 1", 4},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.5", 3.5},
+		{"-2.5", -2.5},
+		{".5 + .25", 0.75},
+		{"1 + 2.5", 3.5},
+		{"2.5 + 1", 3.5},
+		{"10 / 4.0", 2.5},
+		{"3 * 1.5 - 1", 3.5},
+		{"1e3 * 2", 2000},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testFloatObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestNumericPromotion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"10 / 4", 2},
+		{"1 + 2", 3},
+		{"1 == 1.0", true},
+		{"1 < 1.5", true},
+		{"2.0 > 3", false},
+		{"0.1 + 0.2 != 0.3", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"3.0", "3.0"},
+		{"1.5 * 2", "3.0"},
+		{"0.1", "0.1"},
+		{"1e21", "1e+21"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect() for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestEvalBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 > 1", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 == 2", false},
+		{"1 != 2", true},
+		{"true == true", true},
+		{"false == false", true},
+		{"true == false", false},
+		{"true != false", true},
+		{"false != true", true},
+		{"(1 < 2) == true", true},
+		{"(1 < 2) == false", false},
+		{"(1 > 2) == true", false},
+		{"(1 > 2) == false", true},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"2.5 >= 2", true},
+		{"1 <= 0.5", false},
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
+		{"0 && 1", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestBangOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"!true", false},
+		{"!false", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!!false", false},
+		{"!!5", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestLogicalOperatorsShortCircuit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"false && foobar", false},
+		{"true || foobar", true},
+		{"let boom = fn() { 1 + true }; false && boom()", false},
+		{"let boom = fn() { 1 + true }; true || boom()", true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestFloatModulo(t *testing.T) {
+	testFloatObject(t, testEval(t, "7.5 % 2"), 1.5)
+}
+
+func TestIfElseExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", nil},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (true) {}", nil},
+		{"if (false) { 10 } else {}", nil},
+		{"if (true) { let x = 1; }", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{"return;", nil},
+		{
+			`if (10 > 1) {
+				if (10 > 1) {
+					return 10;
+				}
+
+				return 1;
+			}`,
+			10,
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestLetValuelessBlock(t *testing.T) {
+	testNullObject(t, testEval(t, "let x = if (true) {}; x"))
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"5 + true;", "type mismatch: INTEGER + BOOLEAN"},
+		{"5 + true; 5;", "type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"true + false;", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"5; true + false; 5", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"if (10 > 1) { true + false; }", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"foobar", "identifier not found: foobar"},
+		{"10 / 0", "division by zero: 10 / 0"},
+		{"(if (true) {}) + 1", "type mismatch: NULL + INTEGER"},
+		{"let y = if (true) { let x = 1 }; y + 1", "type mismatch: NULL + INTEGER"},
+		{"-if (true) {}", "unknown operator: -NULL"},
+		{`"Hello" - "World"`, "unknown operator: STRING - STRING"},
+		{`"1" + 1`, "type mismatch: STRING + INTEGER"},
+		{"[1, 2][true]", "array index must be INTEGER, got BOOLEAN"},
+		{"1[0]", "index operator not supported: INTEGER"},
+		{"[1, foobar]", "identifier not found: foobar"},
+		{"1.5 / 0", "division by zero: 1.5 / 0"},
+		{"5 % 0", "division by zero: 5 % 0"},
+		{"1 << -1", "negative shift count: 1 << -1"},
+		{"1 << 100000000000000", "shift count too large: 1 << 100000000000000"},
+		{"1 << 4194305", "shift count too large: 1 << 4194305"},
+		{"18446744073709551616 / 0", "division by zero: 18446744073709551616 / 0"},
+		{"18446744073709551616 + true", "type mismatch: BIGINT + BOOLEAN"},
+		{"8 >> -2", "negative shift count: 8 >> -2"},
+		{"(1 << 64) << 100000000000000", "shift count too large: 18446744073709551616 << 100000000000000"},
+		{"1 << 18446744073709551616", "shift count too large: 1 << 18446744073709551616"},
+		{"1.5 & 1", "unknown operator: FLOAT & INTEGER"},
+		{"~true", "unknown operator: ~BOOLEAN"},
+		{"true && foobar", "identifier not found: foobar"},
+		{"-true + 1.5", "unknown operator: -BOOLEAN"},
+		{"1.5 + true", "type mismatch: FLOAT + BOOLEAN"},
+		{`{"name": "Monkey"}[fn(x) { x }];`, "unusable as hash key: FUNCTION"},
+		{`{[1]: 2}`, "unusable as hash key: ARRAY"},
+		{"5(1)", "not a function: INTEGER"},
+		{"fn(x, y) { x + y }(1)", "wrong number of arguments: want=2, got=1"},
+		{"fn(x) { x }(foobar)", "identifier not found: foobar"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		errorObject, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errorObject.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errorObject.Message)
+		}
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x = 1; x = 2; x", 2},
+		{"let x = 1; x = x + 1; x", 2},
+		{"let x = 1; x = 5", 5},
+		{"let x = 10; x += 5; x", 15},
+		{"let x = 10; x -= 5; x", 5},
+		{"let x = 10; x *= 5; x", 50},
+		{"let x = 10; x /= 5; x", 2},
+		{"let x = 1; let y = 2; x = y = 7; x + y", 14},
+		{"let xs = [1, 2, 3]; xs[1] = 20; xs[1]", 20},
+		{"let xs = [1, 2, 3]; xs[-1] += 10; xs[2]", 13},
+		{"let xs = [1, 2, 3]; let ys = xs; ys[0] = 9; xs[0]", 9},
+		{`let h = {"a": 1}; h["a"] += 1; h["a"]`, 2},
+		{`let h = {}; h["b"] = 3; h["b"]`, 3},
+		{"let x = 9223372036854775807; x -= 1; x", 9223372036854775806},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestAssignmentUpdatesDefiningScope(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x = 1; let set = fn() { x = 2; }; set(); x", 2},
+		{"let x = 1; let add = fn(n) { x += n; }; add(2); add(3); x", 6},
+		{"let x = 1; let f = fn() { let x = 5; x = 6; x }; f() + x", 7},
+		{"let x = 1; let f = fn(x) { x = 10; }; f(2); x", 1},
+		{"let x = 1; let f = fn() { fn() { x *= 3; } }; f()(); f()(); x", 9},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestInspectSelfReference(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = [1]; a[0] = a; a", "[[...]]"},
+		{`let h = {"k": 1}; h["k"] = h; h`, `{"k": {...}}`},
+		{`let a = [1]; let h = {"a": a}; a[0] = h; a`, `[{"a": [...]}]`},
+		{"let a = [1]; let b = [a, a]; b", "[[1], [1]]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestAssignmentErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"y = 1", "identifier not found: y"},
+		{"let f = fn() { z = 1 }; f()", "identifier not found: z"},
+		{"let x = 1; x += true", "type mismatch: INTEGER + BOOLEAN"},
+		{"let x = 1; x /= 0", "division by zero: 1 / 0"},
+		{"let xs = [1]; xs[1] = 2", "index out of range: 1"},
+		{`let xs = [1]; xs["a"] = 2`, "array index must be INTEGER, got STRING"},
+		{`let h = {}; h["a"] += 1`, "key not found: a"},
+		{`let h = {}; h[fn(x) { x }] = 1`, "unusable as hash key: FUNCTION"},
+		{`let s = "abc"; s[0] = "x"`, "index assignment not supported: STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let i = 0; while (i < 10) { i += 1; } i", 10},
+		{"let sum = 0; for (let i = 1; i <= 100; i += 1) { sum += i; } sum", 5050},
+		{"let i = 0; for (;;) { i += 1; if (i == 5) { break; } } i", 5},
+		{"let i = 0; while (true) { i += 1; if (i >= 7) { break } } i", 7},
+		{"let sum = 0; for (let i = 0; i < 10; i += 1) { if (i % 2 == 0) { continue; } sum += i; } sum", 25},
+		{"let i = 0; let n = 0; while (i < 10) { i += 1; if (i > 3) { continue } n += 1; } n", 3},
+		{"let n = 0; for (let i = 0; i < 3; i += 1) { for (let j = 0; j < 3; j += 1) { if (j == 1) { break } n += 1 } } n", 3},
+		{"let i = 0; for (i = 0; i < 4; i += 1) {} i", 4},
+		{"let i = 42; for (let i = 0; i < 4; i += 1) {} i", 42},
+		{"let find = fn(xs, x) { let i = 0; while (i < 3) { if (xs[i] == x) { return i; } i += 1; } -1 }; find([5, 6, 7], 7)", 2},
+		{"let i = 0; while (i < 100000) { i += 1 } i", 100000},
+		{"let i = 0; while (i < 3) { i += 1 }; i", 3},
+		{"let sum = 0; for (let i = 1; i <= 3; i += 1) { sum += i }; sum", 6},
+		{"let find = fn(xs, x) { let i = 0; while (i < 3) { if (xs[i] == x) { return i; } i += 1; }; -1 }; find([5, 6, 7], 8)", -1},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestForInLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let sum = 0; for (x in [1, 2, 3]) { sum += x; } sum", 6},
+		{"let sum = 0; for (i, x in [10, 20, 30]) { sum += i * x; } sum", 80},
+		{"let sum = 0; for (i in 0..10) { sum += i; } sum", 45},
+		{"let sum = 0; for (i in 0..=10) { sum += i; } sum", 55},
+		{"let n = 0; for (i in 5..5) { n += 1; } n", 0},
+		{"let n = 0; for (i in 5..=5) { n += 1; } n", 1},
+		{"let n = 0; for (i in 5..0) { n += 1; } n", 0},
+		{"let sum = 0; for (i, x in 10..13) { sum += i; } sum", 3},
+		{`let s = ""; for (c in "héllo") { s = c + s; } s`, "olléh"},
+		{`let n = 0; for (i, c in "日本語") { n = i; } n`, 2},
+		{`let s = ""; for (k in {"a": 1, "b": 2}) { s += k; } s`, "ab"},
+		{`let sum = 0; for (k, v in {"a": 1, "b": 2}) { sum += v; } sum`, 3},
+		{"let sum = 0; for (i in 0..100) { if (i == 5) { break; } sum += i; } sum", 10},
+		{"let sum = 0; for (i in 0..10) { if (i % 2 == 1) { continue; } sum += i; } sum", 20},
+		{"let first = fn(xs) { for (x in xs) { if (x > 2) { return x; } } -1 }; first([1, 3, 5])", 3},
+		{"let xs = [0, 0, 0]; for (i in 0..3) { xs[i] = fn() { i }; } xs[0]() + xs[2]()", 2},
+		{"let x = 42; for (x in 0..3) {} x", 42},
+		{"let n = 0; for (i in 0..1000000) { n += 1; } n", 1000000},
+		{"let r = 0; for (x in [1, 2]) { r += x }; r", 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("%s: expected %q. got=%T (%+v)", tt.input, expected, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestRangeObject(t *testing.T) {
+	evaluated := testEval(t, "let n = 3; 1..=n")
+	r, ok := evaluated.(*object.Range)
+	if !ok {
+		t.Fatalf("object is not Range. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if r.From != 1 || r.To != 3 || !r.Inclusive {
+		t.Errorf("range wrong. got=%s", r.Inspect())
+	}
+}
+
+func TestLoopsEvaluateToNull(t *testing.T) {
+	tests := []string{
+		"while (false) { 1 }",
+		"let i = 0; while (i < 2) { i += 1; i }",
+		"for (let i = 0; i < 2; i += 1) { 5 }",
+		"for (;;) { break }",
+	}
+
+	for _, input := range tests {
+		testNullObject(t, testEval(t, input))
+	}
+}
+
+// break, continue and return inside an expression end the whole expression,
+// as well as the statement it is in
+func TestAbruptResultsInExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let s = 0; for (let i = 0; i < 3; i += 1) { 1 + if (true) { continue }; s += 1 } s", 0},
+		{"let s = 0; for (let i = 0; i < 3; i += 1) { s += 1; -if (i == 1) { break } else { 0 } } s", 2},
+		{"let f = fn(x) { x }; let i = 0; while (i < 3) { i += 1; f(if (true) { continue }) } i", 3},
+		{"let s = 0; let i = 0; while (i < 3) { i += 1; s += if (i == 2) { continue } else { i } } s", 4},
+		{"let s = 0; for (let i = 0; i < 5; i += 1) { let a = [1, if (i == 2) { break }]; s += 1 } s", 2},
+		{`let s = 0; for (let i = 0; i < 5; i += 1) { let h = {"k": if (i == 3) { break }}; s += 1 } s`, 3},
+		{"let s = 0; for (let i = 0; i < 5; i += 1) { [1][if (i == 1) { break } else { 0 }]; s += 1 } s", 1},
+		{"let s = 0; for (i in 0..3) { 1 + if (true) { continue }; s += 1 } s", 0},
+		{"let s = 0; for (i in 0..5) { let a = [1, if (i == 2) { break }]; s += 1 } s", 2},
+		{"let s = 0; for (x in [1, 2]) { for (i in 0..if (x == 2) { break } else { 3 }) { s += 1 } } s", 3},
+		{"let f = fn() { 1 + if (true) { return 5 } }; f()", 5},
+		{"let f = fn() { let x = if (true) { return 7 }; 0 }; f()", 7},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestLoopErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"while (x) {}", "identifier not found: x"},
+		{"let i = 0; while (true) { i += true }", "type mismatch: INTEGER + BOOLEAN"},
+		{"for (let i = 0; i < 3; i += y) {}", "identifier not found: y"},
+		{"for (let i = 0; i < 3; i += 1) {} i", "identifier not found: i"},
+		{"for (x in 5) {}", "not iterable: INTEGER"},
+		{"for (x in xs) {}", "identifier not found: xs"},
+		{"0..1.5", "range bounds must be INTEGER, got INTEGER..FLOAT"},
+		{`"a"..="z"`, "range bounds must be INTEGER, got STRING..=STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) { x + 2; };"
+
+	evaluated := testEval(t, input)
+	function, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(function.Parameters) != 1 {
+		t.Fatalf("function has wrong parameters. Parameters=%+v", function.Parameters)
+	}
+
+	if function.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", function.Parameters[0])
+	}
+
+	expectedBody := "(x + 2)"
+
+	if function.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, function.Body.String())
+	}
+}
+
+func TestStringLiteral(t *testing.T) {
+	input := `"Hello World!"`
+
+	evaluated := testEval(t, input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestStringConcatenation(t *testing.T) {
+	input := `"Hello" + " " + "World!"`
+
+	evaluated := testEval(t, input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`"a" + "b" == "ab"`, true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	evaluated := testEval(t, input)
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong num of elements. got=%d", len(result.Elements))
+	}
+
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+
+	if result.Inspect() != "[1, 4, 6]" {
+		t.Errorf("array.Inspect() wrong. got=%q", result.Inspect())
+	}
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][2]", 3},
+		{"let i = 0; [1][i];", 1},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"let myArray = [1, 2, 3]; myArray[2];", 3},
+		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
+		{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", 2},
+		{"[[1, 2], [3, 4]][1][0]", 3},
+		{"[fn(x) { x * 2 }][0](21)", 42},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-3]", 1},
+		{"[1, 2, 3][-4]", nil},
+		{"[][0]", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+
+	evaluated := testEval(t, input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := []struct {
+		key   object.Hashable
+		value int64
+	}{
+		{&object.String{Value: "one"}, 1},
+		{&object.String{Value: "two"}, 2},
+		{&object.String{Value: "three"}, 3},
+		{&object.Integer{Value: 4}, 4},
+		{TRUE, 5},
+		{FALSE, 6},
+	}
+
+	if result.Len() != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", result.Len())
+	}
+
+	for _, tt := range expected {
+		value, ok := result.Get(tt.key)
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+		}
+
+		testIntegerObject(t, value, tt.value)
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+		{`{"a": 1, "a": 2}["a"]`, 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+		{"let f = fn() { return 1; 2 }; f() + 1", 2},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`
+		let newAdder = fn(x) { fn(y) { x + y } };
+		let addTwo = newAdder(2);
+		addTwo(3);`, 5},
+		{`
+		let newCounter = fn() {
+			let count = 0;
+			fn() { count += 1; count }
+		};
+		let a = newCounter();
+		let b = newCounter();
+		a(); a(); b();
+		a() * 10 + b()`, 32},
+		{`
+		let x = 1;
+		let getX = fn() { x };
+		x = 2;
+		getX()`, 2},
+		{`
+		let makeAccount = fn(balance) {
+			let deposit = fn(n) { balance += n; };
+			let read = fn() { balance };
+			[deposit, read]
+		};
+		let account = makeAccount(10);
+		account[0](5);
+		account[0](7);
+		account[1]()`, 22},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestCurrying(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let add = fn(a) { fn(b) { fn(c) { a + b + c } } }; add(1)(2)(3)", 6},
+		{"let add = fn(a) { fn(b) { fn(c) { a + b + c } } }; let addOne = add(1); addOne(10)(100) + addOne(20)(200)", 332},
+		{`
+		let curry = fn(f) { fn(a) { fn(b) { f(a, b) } } };
+		let multiply = curry(fn(a, b) { a * b });
+		let triple = multiply(3);
+		triple(7)`, 21},
+		{`
+		let compose = fn(f, g) { fn(x) { f(g(x)) } };
+		let inc = fn(x) { x + 1 };
+		let double = fn(x) { x * 2 };
+		compose(inc, double)(5) * 100 + compose(double, inc)(5)`, 1112},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestHigherOrderFunctions(t *testing.T) {
+	definitions := `
+	let map = fn(f, xs) {
+		let out = [];
+		for (x in xs) { out = push(out, f(x)); };
+		out
+	};
+	let filter = fn(keep, xs) {
+		let out = [];
+		for (x in xs) { if (keep(x)) { out = push(out, x); } };
+		out
+	};
+	let reduce = fn(f, initial, xs) {
+		let acc = initial;
+		for (x in xs) { acc = f(acc, x); };
+		acc
+	};
+	`
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"map(fn(x) { x * 2 }, [1, 2, 3])", "[2, 4, 6]"},
+		{"map(fn(x) { x * 2 }, [])", "[]"},
+		{"filter(fn(x) { x % 2 == 0 }, [1, 2, 3, 4])", "[2, 4]"},
+		{"reduce(fn(acc, x) { acc + x }, 0, [1, 2, 3, 4])", "10"},
+		{"let factor = 3; map(fn(x) { x * factor }, [1, 2])", "[3, 6]"},
+		{"reduce(fn(acc, f) { f(acc) }, 1, map(fn(n) { fn(x) { x * n } }, [2, 3, 4]))", "24"},
+		{"let arr = [1, 2]; map(fn(x) { x * 2 }, arr); arr", "[1, 2]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, definitions+tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let countdown = fn(n) { if (n == 0) { 0 } else { countdown(n - 1) } }; countdown(1000000)", 0},
+		{"let sum = fn(n, acc) { if (n == 0) { return acc; } return sum(n - 1, acc + n); }; sum(1000000, 0)", 500000500000},
+		{`
+		let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+		let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+		if (isEven(1000001)) { 1 } else { 0 }`, 0},
+		{`
+		let loop = fn(n) {
+			if (n > 0) {
+				if (n % 2 == 0) { loop(n - 1) } else { loop(n - 1) }
+			} else { 7 }
+		};
+		loop(1000000)`, 7},
+		{"let count = fn(n) { while (true) { return if (n == 0) { 3 } else { count(n - 1) }; } }; count(1000000)", 3},
+		{"let last = fn(xs) { len(xs) }; last([1, 2])", 2},
+		{"let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(10)", 3628800},
+		{"let f = fn(n) { if (n == 0) { 1 } else { return f(n - 1); } }; return f(100000);", 1},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestTailCallErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"let f = fn(n) { g(n) }; f(1)", "identifier not found: g"},
+		{"let f = fn(n) { if (n == 0) { 1(2) } else { f(n - 1) } }; f(10)", "not a function: INTEGER"},
+		{"let f = fn(n) { if (n == 0) { f() } else { f(n - 1) } }; f(10)", "wrong number of arguments: want=1, got=0"},
+		{"let f = fn(n) { if (n == 0) { x } else { f(n - 1, y) } }; f(10)", "identifier not found: y"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestParameterShadowing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x = 10; let f = fn(x) { x * 2 }; f(3) + x", 16},
+		{"let x = 10; let f = fn(x) { x = 99; x }; f(1) + x", 109},
+		{"let x = 10; let f = fn(y) { let x = y; x }; f(1) + x", 11},
+		{"let x = 1; let f = fn(x) { fn() { x } }; f(5)() + x", 6},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("héllo")`, 5},
+		{"len([1, 2, 3])", 3},
+		{`len({"a": 1})`, 1},
+		{"len(1)", "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments: want=1, got=2"},
+		{"len(push([1], 2))", 2},
+		{"push(1, 1)", "first argument to `push` must be ARRAY, got INTEGER"},
+		{"let len = fn(x) { 42 }; len([])", 42},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestEmptyFunctionBody(t *testing.T) {
+	testNullObject(t, testEval(t, "fn() {}()"))
+}
+
+// an if in tail position whose branch has no value is null, as it is
+// anywhere else
+func TestValuelessTailBranch(t *testing.T) {
+	tests := []string{
+		"let f = fn() { return if (true) {} }; f()",
+		"let f = fn() { if (true) { let x = 1; } }; f()",
+		"let f = fn(n) { if (n > 0) { f(n - 1) } else {} }; f(3)",
+	}
+
+	for _, input := range tests {
+		testNullObject(t, testEval(t, input))
+	}
+}
+
+func testEval(t *testing.T, input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	for _, msg := range p.Errors() {
+		t.Errorf("parser error: %q", msg.Message)
+	}
+
+	env := object.NewEnvironment()
+
+	return Eval(program, env)
+}
+
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"4294967296 * 4294967296", "18446744073709551616"},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808"},
+		{"(-9223372036854775807 - 1) / -1", "9223372036854775808"},
+		{"1 << 64", "18446744073709551616"},
+		{"123456789012345678901234567890", "123456789012345678901234567890"},
+		{"~18446744073709551616", "-18446744073709551617"},
+		{"0xFFFF_FFFF_FFFF_FFFF_FF & 0x1_0000_0000_0000_0000", "18446744073709551616"},
+		{"let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(25)",
+			"15511210043330985984000000"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		result, ok := evaluated.(*object.BigInt)
+		if !ok {
+			t.Errorf("%s: object is not BigInt. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: object has wrong value. got=%s, want=%s", tt.input, result.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestBigIntegersDemote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"9223372036854775808 - 1", 9223372036854775807},
+		{"(9223372036854775807 + 1) - 1", 9223372036854775807},
+		{"(1 << 64) >> 64", 1},
+		{"18446744073709551616 % 10", 6},
+		{"18446744073709551616 / 18446744073709551616", 1},
+		{"-9223372036854775808", -9223372036854775808},
+		{"let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(30) / fact(29)", 30},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestBigIntegerComparisons(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"18446744073709551616 > 1", true},
+		{"18446744073709551616 == 1 << 64", true},
+		{"18446744073709551616 != 18446744073709551617", true},
+		{"-18446744073709551616 < -9223372036854775808", true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(t, tt.input), tt.expected)
+	}
+
+	testFloatObject(t, testEval(t, "18446744073709551616 / 2.0"), 9223372036854775808.0)
+}
+
+func TestBigIntegerHashKeys(t *testing.T) {
+	evaluated := testEval(t, `{18446744073709551616: "big", 0: "small"}[1 << 64]`)
+	str, ok := evaluated.(*object.String)
+	if !ok || str.Value != "big" {
+		t.Fatalf("expected \"big\". got=%T (%+v)", evaluated, evaluated)
+	}
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%t, want=%t", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func testNullObject(t *testing.T, obj object.Object) bool {
+	if obj != NULL {
+		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,46 @@
+package evaluator
+
+import "github.com/gavwyh/go-interpreter/object"
+
+// the parts of the language that work on values rather than on the syntax
+// tree. They are exported so that the vm package runs compiled code with
+// exactly the same operators, indexing and errors as Eval
+
+// applies a prefix operator such as - or ! to an evaluated operand
+func PrefixOperator(operator string, right object.Object) object.Object {
+	return evalPrefixExpression(operator, right)
+}
+
+// applies an infix operator such as + or == to evaluated operands. The
+// logical operators && and || are not included, because they decide whether
+// to evaluate their right operand at all
+func InfixOperator(operator string, left, right object.Object) object.Object {
+	return evalInfixExpression(operator, left, right)
+}
+
+func Index(left, index object.Object) object.Object {
+	return evalIndexExpression(left, index)
+}
+
+// stores value at index in left for an assignment such as xs[i] += 1, where
+// operator is the assignment operator
+func AssignIndex(operator string, left, index, value object.Object) object.Object {
+	return assignIndex(operator, left, index, value)
+}
+
+func MakeRange(from, to object.Object, inclusive bool) object.Object {
+	return makeRange(from, to, inclusive)
+}
+
+// the value a for-in loop with a single variable binds for each element
+func LoopElement(iterable object.Iterable, key, element object.Object) object.Object {
+	return loopElement(iterable, key, element)
+}
+
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
+func NativeBoolToBooleanObject(input bool) *object.Boolean {
+	return nativeBoolToBooleanObject(input)
+}
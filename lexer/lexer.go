@@ -1,44 +1,202 @@
 package lexer
 
-import "github.com/gavwyh/go-interpreter/token"
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/gavwyh/go-interpreter/diagnostic"
+	"github.com/gavwyh/go-interpreter/token"
+)
+
+// diagnostic codes reported by the lexer
+const (
+	CodeIllegalCharacter = "L0001"
+	CodeUnterminatedString = "L0002"
+	CodeInvalidEscape = "L0003"
+	CodeInvalidUTF8 = "L0004"
+	CodeReadError = "L0005"
+	CodeUnterminatedComment = "L0006"
+	CodeMalformedNumber = "L0007"
+)
+
+// flags changing what the lexer produces
+type Mode uint
+
+const (
+	// return comments as COMMENT tokens instead of skipping them, for tools
+	// such as formatters that need to preserve them
+	ScanComments Mode = 1 << iota
+)
+
+// reads UTF-8 input one rune at a time. Offsets are in bytes, columns are in
+// runes. The input is consumed incrementally, so only the current token and
+// a few characters of lookahead are ever held in memory
 type Lexer struct {
-	input        string
-	position     int
-	readPosition int
-	ch           byte
+	filename     string
+	reader       *bufio.Reader
+	ahead        []char // decoded but not yet consumed, for peeking
+	position     int // byte offset of ch
+	readPosition int // byte offset of the rune after ch
+	ch           rune
+
+	// line and column of ch
+	line   int
+	column int
+
+	// ch was decoded from a malformed byte, which has already been reported
+	invalid bool
+
+	// the input has run out. ch is then 0, which is otherwise a NUL in the
+	// input and lexed like any other illegal character
+	eof bool
+
+	mode Mode
+
+	errors []diagnostic.Diagnostic
+}
+
+// a decoded character of input
+type char struct {
+	ch      rune
+	width   int // in bytes
+	invalid bool // ch is utf8.RuneError standing in for the malformed byte raw
+	raw     byte
+	eof     bool
 }
 
 func New(input string) *Lexer {
-	lexer := &Lexer{input: input}
+	return NewFile("", input)
+}
+
+// same as New, but every token position records filename
+func NewFile(filename string, input string) *Lexer {
+	return NewReader(filename, strings.NewReader(input))
+}
+
+// lexes r incrementally through a buffered reader instead of requiring the
+// whole program up front, e.g for pipes or large generated scripts. A read
+// error ends the input and is reported through Errors
+func NewReader(filename string, r io.Reader) *Lexer {
+	lexer := &Lexer{filename: filename, reader: bufio.NewReader(r), line: 1}
 	lexer.readChar()
 	return lexer
 }
 
+func (lexer *Lexer) SetMode(mode Mode) {
+	lexer.mode = mode
+}
+
+// problems found while reading the input, such as unterminated strings.
+// Tokens are still produced for them so that parsing can carry on
+func (lexer *Lexer) Errors() []diagnostic.Diagnostic {
+	return lexer.errors
+}
+
+func (lexer *Lexer) addError(code string, span diagnostic.Span, format string, a ...interface{}) {
+	lexer.errors = append(lexer.errors, diagnostic.Errorf(code, span, format, a...))
+}
+
 func (lexer *Lexer) readChar() {
-	if lexer.readPosition >= len(lexer.input) {
-		lexer.ch = 0
-	} else {
-		lexer.ch = lexer.input[lexer.readPosition]
+	if lexer.ch == '\n' {
+		lexer.line += 1
+		lexer.column = 0
 	}
+	lexer.column += 1
+
+	next := lexer.peek(0)
+	lexer.ahead = lexer.ahead[1:]
+
 	lexer.position = lexer.readPosition
-	lexer.readPosition += 1
+	lexer.readPosition += next.width
+	lexer.ch = next.ch
+	lexer.invalid = next.invalid
+	lexer.eof = next.eof
+
+	if next.invalid {
+		lexer.addError(CodeInvalidUTF8, diagnostic.Span{Start: lexer.currentPosition(), End: lexer.nextPosition()},
+			"invalid UTF-8 encoding (byte %#x)", next.raw)
+	}
+}
+
+// returns the character n places after the current one, decoding as much
+// input as needed
+func (lexer *Lexer) peek(n int) char {
+	for len(lexer.ahead) <= n {
+		lexer.ahead = append(lexer.ahead, lexer.decode())
+	}
+	return lexer.ahead[n]
+}
+
+func (lexer *Lexer) decode() char {
+	if lexer.reader == nil {
+		return char{eof: true}
+	}
+
+	ch, width, err := lexer.reader.ReadRune()
+	if err != nil {
+		if err != io.EOF {
+			pos := lexer.currentPosition()
+			lexer.addError(CodeReadError, diagnostic.Span{Start: pos, End: pos}, "%s", err)
+		}
+		// nothing more will be read, even if the reader has more to give
+		lexer.reader = nil
+		return char{eof: true}
+	}
+
+	if ch == utf8.RuneError && width == 1 {
+		lexer.reader.UnreadRune()
+		raw, _ := lexer.reader.ReadByte()
+		return char{ch: ch, width: width, invalid: true, raw: raw}
+	}
+
+	return char{ch: ch, width: width}
 }
 
 func (lexer *Lexer) NextToken() token.Token {
 	var tok token.Token
 
 	lexer.skipWhitespace()
+	start := lexer.currentPosition()
+
+	for lexer.isCommentStart() {
+		comment := lexer.readComment(start)
+		if lexer.mode&ScanComments != 0 {
+			return lexer.locate(token.Token{Type: token.COMMENT, Literal: comment}, start)
+		}
+
+		lexer.skipWhitespace()
+		start = lexer.currentPosition()
+	}
+
+	if lexer.eof {
+		// stay put so that every further call returns EOF at the same position
+		return lexer.locate(token.Token{Type: token.EOF}, start)
+	}
+
+	if tok, ok := lexer.readOperator(); ok {
+		lexer.readChar()
+		return lexer.locate(tok, start)
+	}
 
 	switch lexer.ch {
 	case '-':
 		tok = newToken(token.MINUS, lexer.ch)
 	case '!':
-		if literal, isComparison := lexer.readComparison(); isComparison {
-			tok = token.Token{Type: token.NOT_EQ, Literal: literal}
-		} else {
-			tok = newToken(token.BANG, lexer.ch)
-		}
+		tok = newToken(token.BANG, lexer.ch)
+	case '%':
+		tok = newToken(token.PERCENT, lexer.ch)
+	case '&':
+		tok = newToken(token.AMPERSAND, lexer.ch)
+	case '|':
+		tok = newToken(token.PIPE, lexer.ch)
+	case '^':
+		tok = newToken(token.CARET, lexer.ch)
+	case '~':
+		tok = newToken(token.TILDE, lexer.ch)
 	case '/':
 		tok = newToken(token.SLASH, lexer.ch)
 	case '*':
@@ -48,13 +206,11 @@ func (lexer *Lexer) NextToken() token.Token {
 	case '>':
 		tok = newToken(token.GT, lexer.ch)
 	case '=':
-		if literal, isComparison := lexer.readComparison(); isComparison {
-			tok = token.Token{Type: token.EQ, Literal: literal}
-		} else {
-			tok = newToken(token.ASSIGN, lexer.ch)
-		}
+		tok = newToken(token.ASSIGN, lexer.ch)
 	case ';':
 		tok = newToken(token.SEMICOLON, lexer.ch)
+	case ':':
+		tok = newToken(token.COLON, lexer.ch)
 	case '(':
 		tok = newToken(token.LPAREN, lexer.ch)
 	case ')':
@@ -67,59 +223,374 @@ func (lexer *Lexer) NextToken() token.Token {
 		tok = newToken(token.LBRACE, lexer.ch)
 	case '}':
 		tok = newToken(token.RBRACE, lexer.ch)
-	case 0:
-		tok.Literal = ""
-		tok.Type = token.EOF
+	case '[':
+		tok = newToken(token.LBRACKET, lexer.ch)
+	case ']':
+		tok = newToken(token.RBRACKET, lexer.ch)
+	case '"':
+		literal, terminated := lexer.readString(start)
+		tok = token.Token{Type: token.STRING, Literal: literal}
+		if !terminated {
+			return lexer.locate(tok, start)
+		}
 	default:
 		if isLetter(lexer.ch) {
 			tok.Literal = lexer.readIdentifier()
 			tok.Type = token.LookupIdentifier(tok.Literal)
-			return tok
-		} else if isDigit(lexer.ch) {
-			tok.Type = token.INT
-			tok.Literal = lexer.readNumber()
-			return tok
+			return lexer.locate(tok, start)
+		} else if isDigit(lexer.ch) || lexer.ch == '.' && isDigit(lexer.peekChar()) {
+			tok.Literal, tok.Type = lexer.readNumber()
+			return lexer.locate(tok, start)
 		} else {
 			tok = newToken(token.ILLEGAL, lexer.ch)
+			if !lexer.invalid {
+				lexer.addError(CodeIllegalCharacter, diagnostic.Span{Start: start, End: lexer.nextPosition()},
+					"illegal character %q", lexer.ch)
+			}
 		}
 	}
 	lexer.readChar()
+	return lexer.locate(tok, start)
+}
+
+// position of the current character
+func (lexer *Lexer) currentPosition() token.Position {
+	return token.Position{
+		Filename: lexer.filename,
+		Offset: lexer.position,
+		Line: lexer.line,
+		Column: lexer.column,
+	}
+}
+
+// marks tok as spanning from start up to the current character
+func (lexer *Lexer) locate(tok token.Token, start token.Position) token.Token {
+	tok.Pos = start
+	tok.End = lexer.currentPosition()
 	return tok
 }
 
-func (lexer *Lexer) peekChar() byte {
-	if lexer.readPosition >= len(lexer.input) {
-		return 0
-	} else {
-		return lexer.input[lexer.readPosition]
+func (lexer *Lexer) peekChar() rune {
+	return lexer.peekCharAt(1)
+}
+
+// looks ahead n characters past the current one without consuming them
+func (lexer *Lexer) peekCharAt(n int) rune {
+	return lexer.peek(n - 1).ch
+}
+
+// reads an integer, or a float when there is a fraction (1.5, .5) or an
+// exponent (1e9, 2.5E-3), keeping its original spelling. A '.' only starts a
+// fraction when a digit follows it, so 1..5 is the integer 1 followed by
+// '..'. Integers may have a 0x, 0o or 0b prefix and any run of digits may
+// use _ as a separator e.g. 0xFF, 0b1010, 1_000_000, but a decimal integer
+// cannot have a leading zero. A malformed literal is reported here and
+// returned as ILLEGAL so that the parser does not report it again
+func (lexer *Lexer) readNumber() (string, token.TokenType) {
+	var out strings.Builder
+	var tokenType token.TokenType = token.INT
+
+	if lexer.ch == '0' {
+		if base, name := numberBase(lexer.peekChar()); base != 0 {
+			return lexer.readPrefixedInteger(&out, base, name)
+		}
+	}
+
+	// a decimal integer may not start with 0, which would otherwise read as
+	// octal the way it does in C, so that 010 is not quietly 8
+	var leadingZero *diagnostic.Span
+	if lexer.ch == '0' && (isDigit(lexer.peekChar()) || lexer.peekChar() == '_') {
+		leadingZero = &diagnostic.Span{Start: lexer.currentPosition(), End: lexer.nextPosition()}
+		lexer.consume(&out)
+	}
+
+	ok := lexer.readDigits(&out, 10, "decimal")
+
+	if lexer.ch == '.' && isDigit(lexer.peekChar()) {
+		tokenType = token.FLOAT
+		lexer.consume(&out)
+		ok = lexer.readDigits(&out, 10, "decimal") && ok
+	}
+
+	if lexer.ch == 'e' || lexer.ch == 'E' {
+		sign := lexer.peekChar() == '+' || lexer.peekChar() == '-'
+		if isDigit(lexer.peekChar()) || sign && isDigit(lexer.peekCharAt(2)) {
+			tokenType = token.FLOAT
+			lexer.consume(&out)
+			if sign {
+				lexer.consume(&out)
+			}
+			ok = lexer.readDigits(&out, 10, "decimal") && ok
+		}
+	}
+
+	if ok && tokenType == token.INT && leadingZero != nil {
+		lexer.addError(CodeMalformedNumber, *leadingZero,
+			"leading zero in decimal literal, use 0o for an octal literal")
+		ok = false
 	}
+
+	if !ok {
+		return out.String(), token.ILLEGAL
+	}
+	return out.String(), tokenType
 }
 
-// this can be abstracted -> either via arg or interfaces
-func (lexer *Lexer) readNumber() string {
-	position := lexer.position
-	for isDigit(lexer.ch) {
-		lexer.readChar()
+// reads an integer such as 0x1F starting at its leading 0
+func (lexer *Lexer) readPrefixedInteger(out *strings.Builder, base int, name string) (string, token.TokenType) {
+	start := lexer.currentPosition()
+	lexer.consume(out)
+	lexer.consume(out)
+
+	prefix := out.Len()
+	if !lexer.readDigits(out, base, name) {
+		return out.String(), token.ILLEGAL
+	}
+
+	if strings.Trim(out.String()[prefix:], "_") == "" {
+		lexer.addError(CodeMalformedNumber, diagnostic.Span{Start: start, End: lexer.currentPosition()},
+			"%s literal has no digits", name)
+		return out.String(), token.ILLEGAL
+	}
+	return out.String(), token.INT
+}
+
+// reads a run of digits in the given base, where a single _ may separate two
+// digits. After a base prefix any letters are read too, so that 0b102 is one
+// malformed literal rather than 0b10 followed by 2. Only the first problem
+// in the run is reported, and false is returned if there was one
+func (lexer *Lexer) readDigits(out *strings.Builder, base int, name string) bool {
+	ok := true
+	var underscore *token.Position
+
+	for isDigit(lexer.ch) || lexer.ch == '_' || base != 10 && isLetter(lexer.ch) {
+		pos := lexer.currentPosition()
+
+		if lexer.ch == '_' {
+			if underscore != nil && ok {
+				lexer.addError(CodeMalformedNumber, diagnostic.Span{Start: pos, End: lexer.nextPosition()},
+					"'_' must separate successive digits")
+				ok = false
+			}
+			underscore = &pos
+		} else {
+			underscore = nil
+			if digitValue(lexer.ch) >= base && ok {
+				lexer.addError(CodeMalformedNumber, diagnostic.Span{Start: pos, End: lexer.nextPosition()},
+					"invalid digit %q in %s literal", lexer.ch, name)
+				ok = false
+			}
+		}
+		lexer.consume(out)
 	}
-	return lexer.input[position:lexer.position]
+
+	if underscore != nil && ok {
+		lexer.addError(CodeMalformedNumber, diagnostic.Span{Start: *underscore, End: lexer.currentPosition()},
+			"'_' must separate successive digits")
+		ok = false
+	}
+	return ok
 }
 
+// identifiers start with a letter and carry on with letters or digits, in
+// any script e.g café, 変数, x1
 func (lexer *Lexer) readIdentifier() string {
-	position := lexer.position
-	for isLetter(lexer.ch) {
+	var out strings.Builder
+	for isLetter(lexer.ch) || unicode.IsDigit(lexer.ch) {
+		lexer.consume(&out)
+	}
+	return out.String()
+}
+
+// appends the current character to out and moves on to the next one
+func (lexer *Lexer) consume(out *strings.Builder) {
+	out.WriteRune(lexer.ch)
+	lexer.readChar()
+}
+
+// reads a double quoted string starting at the opening quote and returns its
+// value with escape sequences resolved. The current character is left on the
+// closing quote. A string may not span lines, so a newline or the end of the
+// input before the closing quote leaves it unterminated
+func (lexer *Lexer) readString(start token.Position) (string, bool) {
+	var out strings.Builder
+
+	for {
 		lexer.readChar()
+
+		switch {
+		case lexer.ch == '"':
+			return out.String(), true
+		case lexer.ch == '\n' || lexer.eof:
+			end := lexer.currentPosition()
+			d := diagnostic.Errorf(CodeUnterminatedString, diagnostic.Span{Start: start, End: end},
+				"unterminated string literal")
+			d = d.WithFix(diagnostic.Fix{
+				Message: "insert closing `\"`",
+				Span: diagnostic.Span{Start: end, End: end},
+				Replacement: "\"",
+			})
+			lexer.errors = append(lexer.errors, d)
+			return out.String(), false
+		case lexer.ch == '\\':
+			lexer.readEscape(&out)
+		default:
+			out.WriteRune(lexer.ch)
+		}
 	}
-	return lexer.input[position:lexer.position]
 }
 
-func (lexer *Lexer) readComparison() (string, bool) {
-	literal := string(lexer.ch)
-	if lexer.peekChar() == '=' {
+var escapes = map[rune]rune{
+	'n': '\n',
+	't': '\t',
+	'r': '\r',
+	'"': '"',
+	'\\': '\\',
+}
+
+// called with the current character on a backslash, leaves it on the last
+// character of the escape sequence. Unknown escapes are reported and kept as
+// written
+func (lexer *Lexer) readEscape(out *strings.Builder) {
+	start := lexer.currentPosition()
+
+	if escaped, ok := escapes[lexer.peekChar()]; ok {
 		lexer.readChar()
-		literal += string(lexer.ch)
-		return literal, true
+		out.WriteRune(escaped)
+		return
+	}
+
+	if lexer.peekChar() != 'u' {
+		if lexer.peekChar() == '\n' || lexer.peek(0).eof {
+			// leave the end of the line to readString
+			out.WriteByte('\\')
+			return
+		}
+		lexer.readChar()
+		lexer.addError(CodeInvalidEscape, diagnostic.Span{Start: start, End: lexer.nextPosition()},
+			"unknown escape sequence \\%c", lexer.ch)
+		out.WriteByte('\\')
+		out.WriteRune(lexer.ch)
+		return
+	}
+
+	// \u{XXXX} with one to six hex digits
+	lexer.readChar()
+	if lexer.peekChar() != '{' {
+		lexer.addError(CodeInvalidEscape, diagnostic.Span{Start: start, End: lexer.nextPosition()},
+			"\\u must be followed by {hex digits}")
+		out.WriteString("\\u")
+		return
+	}
+	lexer.readChar()
+
+	var hex strings.Builder
+	for isHexDigit(lexer.peekChar()) {
+		lexer.readChar()
+		hex.WriteRune(lexer.ch)
+	}
+	digits := hex.String()
+
+	if lexer.peekChar() != '}' {
+		lexer.addError(CodeInvalidEscape, diagnostic.Span{Start: start, End: lexer.nextPosition()},
+			"unterminated unicode escape, expected }")
+		out.WriteString("\\u{" + digits)
+		return
+	}
+	lexer.readChar()
+
+	value, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || len(digits) > 6 || !utf8.ValidRune(rune(value)) {
+		lexer.addError(CodeInvalidEscape, diagnostic.Span{Start: start, End: lexer.nextPosition()},
+			"invalid unicode escape \\u{%s}", digits)
+		out.WriteRune(utf8.RuneError)
+		return
+	}
+	out.WriteRune(rune(value))
+}
+
+// position just after the current character
+func (lexer *Lexer) nextPosition() token.Position {
+	pos := lexer.currentPosition()
+	pos.Offset = lexer.readPosition
+	pos.Column += 1
+	return pos
+}
+
+// checks the current character and those after it against the operators
+// spelled with several characters (==, <=, ..=, ...), preferring the longest
+// match. Leaves the current character on the last one of a match
+func (lexer *Lexer) readOperator() (token.Token, bool) {
+	for length := token.MaxOperatorLength; length > 1; length-- {
+		var literal strings.Builder
+		literal.WriteRune(lexer.ch)
+		for i := 1; i < length; i++ {
+			literal.WriteRune(lexer.peekCharAt(i))
+		}
+
+		tokenType, ok := token.LookupOperator(literal.String())
+		if !ok {
+			continue
+		}
+
+		for i := 1; i < length; i++ {
+			lexer.readChar()
+		}
+		return token.Token{Type: tokenType, Literal: literal.String()}, true
+	}
+	return token.Token{}, false
+}
+
+func (lexer *Lexer) isCommentStart() bool {
+	return lexer.ch == '/' && (lexer.peekChar() == '/' || lexer.peekChar() == '*')
+}
+
+// reads a `//` comment up to the end of the line, or a `/* */` comment which
+// may span lines and contain other block comments. Returns the text of the
+// comment including its delimiters and leaves the current character just
+// after it
+func (lexer *Lexer) readComment(start token.Position) string {
+	var out strings.Builder
+
+	if lexer.peekChar() == '/' {
+		for lexer.ch != '\n' && !lexer.eof {
+			lexer.consume(&out)
+		}
+		return strings.TrimSuffix(out.String(), "\r")
+	}
+
+	depth := 0
+	for {
+		switch {
+		case lexer.eof:
+			end := lexer.currentPosition()
+			d := diagnostic.Errorf(CodeUnterminatedComment, diagnostic.Span{Start: start, End: end},
+				"unterminated block comment")
+			if depth > 1 {
+				d = d.WithNote("block comments nest, %d are still open", depth)
+			}
+			d = d.WithFix(diagnostic.Fix{
+				Message: "insert `*/`",
+				Span: diagnostic.Span{Start: end, End: end},
+				Replacement: strings.Repeat("*/", depth),
+			})
+			lexer.errors = append(lexer.errors, d)
+			return out.String()
+		case lexer.ch == '/' && lexer.peekChar() == '*':
+			depth += 1
+			lexer.consume(&out)
+			lexer.consume(&out)
+		case lexer.ch == '*' && lexer.peekChar() == '/':
+			depth -= 1
+			lexer.consume(&out)
+			lexer.consume(&out)
+			if depth == 0 {
+				return out.String()
+			}
+		default:
+			lexer.consume(&out)
+		}
 	}
-	return literal, false
 }
 
 func (lexer *Lexer) skipWhitespace() {
@@ -128,15 +599,46 @@ func (lexer *Lexer) skipWhitespace() {
 	}
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_'
 }
 
-func isDigit(ch byte) bool {
+// only ASCII digits make up number literals
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+// value of ch as a digit in bases up to 16, or 16 if it is not one
+func digitValue(ch rune) int {
+	switch {
+	case isDigit(ch):
+		return int(ch - '0')
+	case 'a' <= ch && ch <= 'f':
+		return int(ch - 'a' + 10)
+	case 'A' <= ch && ch <= 'F':
+		return int(ch - 'A' + 10)
+	}
+	return 16
+}
+
+// base and name of the integer literal prefix 0<ch>, or 0 if there is none
+func numberBase(ch rune) (int, string) {
+	switch ch {
+	case 'x', 'X':
+		return 16, "hexadecimal"
+	case 'o', 'O':
+		return 8, "octal"
+	case 'b', 'B':
+		return 2, "binary"
+	}
+	return 0, ""
+}
+
 // maybe should abstract this creation of token to something else
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
@@ -1,7 +1,12 @@
 package lexer
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/gavwyh/go-interpreter/token"
 )
@@ -15,7 +20,7 @@ func TestNextToken(t *testing.T) {
 	};
 	
 	let result = add(five, ten);
-	!-/*5;
+	!-/ *5;
 	5 < 10 > 5;
 
 	if (5 < 10) {
@@ -26,6 +31,13 @@ func TestNextToken(t *testing.T) {
 
 	10 == 10;
 	10 != 9;
+	[1, 2];
+	{"foo": "bar"}
+	a <= b >= c && d || e % f;
+	~a & b | c ^ d << e >> f;
+	x += 1 -= 2 *= 3 /= 4;
+	while for break continue
+	for (x in 0..10) 1..=n
 	`
 
 	tests := []struct {
@@ -105,6 +117,67 @@ func TestNextToken(t *testing.T) {
 		{token.NOT_EQ, "!="},
 		{token.INT, "9"},
 		{token.SEMICOLON, ";"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.LBRACE, "{"},
+		{token.STRING, "foo"},
+		{token.COLON, ":"},
+		{token.STRING, "bar"},
+		{token.RBRACE, "}"},
+		{token.IDENTIFIER, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENTIFIER, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENTIFIER, "c"},
+		{token.AND, "&&"},
+		{token.IDENTIFIER, "d"},
+		{token.OR, "||"},
+		{token.IDENTIFIER, "e"},
+		{token.PERCENT, "%"},
+		{token.IDENTIFIER, "f"},
+		{token.SEMICOLON, ";"},
+		{token.TILDE, "~"},
+		{token.IDENTIFIER, "a"},
+		{token.AMPERSAND, "&"},
+		{token.IDENTIFIER, "b"},
+		{token.PIPE, "|"},
+		{token.IDENTIFIER, "c"},
+		{token.CARET, "^"},
+		{token.IDENTIFIER, "d"},
+		{token.SHIFT_LEFT, "<<"},
+		{token.IDENTIFIER, "e"},
+		{token.SHIFT_RIGHT, ">>"},
+		{token.IDENTIFIER, "f"},
+		{token.SEMICOLON, ";"},
+		{token.IDENTIFIER, "x"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "1"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INT, "2"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.INT, "3"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.INT, "4"},
+		{token.SEMICOLON, ";"},
+		{token.WHILE, "while"},
+		{token.FOR, "for"},
+		{token.BREAK, "break"},
+		{token.CONTINUE, "continue"},
+		{token.FOR, "for"},
+		{token.LPAREN, "("},
+		{token.IDENTIFIER, "x"},
+		{token.IN, "in"},
+		{token.INT, "0"},
+		{token.DOTDOT, ".."},
+		{token.INT, "10"},
+		{token.RPAREN, ")"},
+		{token.INT, "1"},
+		{token.DOTDOT_EQ, "..="},
+		{token.IDENTIFIER, "n"},
 		{token.EOF, ""},
 	}
 
@@ -122,3 +195,529 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 10;\n  x == 5"
+
+	tests := []struct {
+		expectedLiteral string
+		expectedOffset  int
+		expectedLine    int
+		expectedColumn  int
+		expectedEnd     int
+	}{
+		{"let", 0, 1, 1, 3},
+		{"x", 4, 1, 5, 5},
+		{"=", 6, 1, 7, 7},
+		{"10", 8, 1, 9, 10},
+		{";", 10, 1, 11, 11},
+		{"x", 14, 2, 3, 15},
+		{"==", 16, 2, 5, 18},
+		{"5", 19, 2, 8, 20},
+		{"", 20, 2, 9, 20},
+		{"", 20, 2, 9, 20},
+	}
+
+	l := NewFile("main.mk", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("wrong literal at tests[%d]. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos.Filename != "main.mk" {
+			t.Fatalf("wrong filename at tests[%d]. got=%q", i, tok.Pos.Filename)
+		}
+
+		if tok.Pos.Offset != tt.expectedOffset || tok.Pos.Line != tt.expectedLine ||
+			tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("wrong position at tests[%d]. expected=%d:%d (offset %d), got=%d:%d (offset %d)",
+				i, tt.expectedLine, tt.expectedColumn, tt.expectedOffset,
+				tok.Pos.Line, tok.Pos.Column, tok.Pos.Offset)
+		}
+
+		if tok.End.Offset != tt.expectedEnd {
+			t.Fatalf("wrong end offset at tests[%d]. expected=%d, got=%d", i, tt.expectedEnd, tok.End.Offset)
+		}
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+	}{
+		{`"foobar"`, "foobar"},
+		{`"foo bar"`, "foo bar"},
+		{`""`, ""},
+		{`"a\nb\tc"`, "a\nb\tc"},
+		{`"say \"hi\""`, `say "hi"`},
+		{`"back\\slash"`, `back\slash`},
+		{`"\u{48}\u{49}"`, "HI"},
+		{`"snow\u{2603}man"`, "snow☃man"},
+		{`"\u{1F600}"`, "\U0001F600"},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != token.STRING {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, token.STRING, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.End.Offset != len(tt.input) {
+			t.Fatalf("tests[%d] - token does not span the whole string. got end=%d", i, tok.End.Offset)
+		}
+
+		if len(l.Errors()) != 0 {
+			t.Fatalf("tests[%d] - unexpected errors: %v", i, l.Errors())
+		}
+
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Fatalf("tests[%d] - expected EOF after string, got=%q", i, next.Type)
+		}
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+		expectedCode    string
+		expectedMessage string
+		expectedNext    token.TokenType
+	}{
+		{`"abc`, "abc", CodeUnterminatedString, "unterminated string literal", token.EOF},
+		{"\"abc\nx", "abc", CodeUnterminatedString, "unterminated string literal", token.IDENTIFIER},
+		{`"a\qb"`, `a\qb`, CodeInvalidEscape, `unknown escape sequence \q`, token.EOF},
+		{`"\u{110000}"`, "�", CodeInvalidEscape, `invalid unicode escape \u{110000}`, token.EOF},
+		{`"\u{}"`, "�", CodeInvalidEscape, `invalid unicode escape \u{}`, token.EOF},
+		{`"\u41"`, `\u41`, CodeInvalidEscape, `\u must be followed by {hex digits}`, token.EOF},
+		{`"\u{41"`, `\u{41`, CodeInvalidEscape, "unterminated unicode escape, expected }", token.EOF},
+		{"@", "@", CodeIllegalCharacter, `illegal character '@'`, token.EOF},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		errors := l.Errors()
+		if len(errors) != 1 {
+			t.Errorf("tests[%d] - expected 1 error, got=%d (%v)", i, len(errors), errors)
+			continue
+		}
+
+		if errors[0].Code != tt.expectedCode || errors[0].Message != tt.expectedMessage {
+			t.Errorf("tests[%d] - wrong error. expected=%s %q, got=%s %q",
+				i, tt.expectedCode, tt.expectedMessage, errors[0].Code, errors[0].Message)
+		}
+
+		if next := l.NextToken(); next.Type != tt.expectedNext {
+			t.Errorf("tests[%d] - wrong token after error. expected=%q, got=%q", i, tt.expectedNext, next.Type)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.Token
+	}{
+		{"3.14", []token.Token{{Type: token.FLOAT, Literal: "3.14"}}},
+		{"1e-9", []token.Token{{Type: token.FLOAT, Literal: "1e-9"}}},
+		{"2.5E+3", []token.Token{{Type: token.FLOAT, Literal: "2.5E+3"}}},
+		{"1e10", []token.Token{{Type: token.FLOAT, Literal: "1e10"}}},
+		{".5", []token.Token{{Type: token.FLOAT, Literal: ".5"}}},
+		{"42", []token.Token{{Type: token.INT, Literal: "42"}}},
+		{"1-2.0", []token.Token{
+			{Type: token.INT, Literal: "1"},
+			{Type: token.MINUS, Literal: "-"},
+			{Type: token.FLOAT, Literal: "2.0"},
+		}},
+		{"1e", []token.Token{
+			{Type: token.INT, Literal: "1"},
+			{Type: token.IDENTIFIER, Literal: "e"},
+		}},
+		{"1e+x", []token.Token{
+			{Type: token.INT, Literal: "1"},
+			{Type: token.IDENTIFIER, Literal: "e"},
+			{Type: token.PLUS, Literal: "+"},
+			{Type: token.IDENTIFIER, Literal: "x"},
+		}},
+		{"0x1F", []token.Token{{Type: token.INT, Literal: "0x1F"}}},
+		{"0XdeadBEEF", []token.Token{{Type: token.INT, Literal: "0XdeadBEEF"}}},
+		{"0o755", []token.Token{{Type: token.INT, Literal: "0o755"}}},
+		{"0b1010", []token.Token{{Type: token.INT, Literal: "0b1010"}}},
+		{"0x_ff_ff", []token.Token{{Type: token.INT, Literal: "0x_ff_ff"}}},
+		{"1_000_000", []token.Token{{Type: token.INT, Literal: "1_000_000"}}},
+		{"1_000.000_1e1_0", []token.Token{{Type: token.FLOAT, Literal: "1_000.000_1e1_0"}}},
+		{"0b1+0o7", []token.Token{
+			{Type: token.INT, Literal: "0b1"},
+			{Type: token.PLUS, Literal: "+"},
+			{Type: token.INT, Literal: "0o7"},
+		}},
+		{"0.5", []token.Token{{Type: token.FLOAT, Literal: "0.5"}}},
+		{"1..5", []token.Token{
+			{Type: token.INT, Literal: "1"},
+			{Type: token.DOTDOT, Literal: ".."},
+			{Type: token.INT, Literal: "5"},
+		}},
+		{"1.5...5", []token.Token{
+			{Type: token.FLOAT, Literal: "1.5"},
+			{Type: token.DOTDOT, Literal: ".."},
+			{Type: token.FLOAT, Literal: ".5"},
+		}},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+
+		for j, expected := range tt.expected {
+			tok := l.NextToken()
+
+			if tok.Type != expected.Type || tok.Literal != expected.Literal {
+				t.Fatalf("tests[%d][%d] - wrong token. expected=%s %q, got=%s %q",
+					i, j, expected.Type, expected.Literal, tok.Type, tok.Literal)
+			}
+		}
+
+		if tok := l.NextToken(); tok.Type != token.EOF {
+			t.Fatalf("tests[%d] - expected EOF, got=%s %q", i, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestMalformedNumbers(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+		expectedMessage string
+		expectedStart   int
+		expectedEnd     int
+	}{
+		{"0x", "0x", "hexadecimal literal has no digits", 0, 2},
+		{"0b", "0b", "binary literal has no digits", 0, 2},
+		{"0o", "0o", "octal literal has no digits", 0, 2},
+		{"0b102", "0b102", "invalid digit '2' in binary literal", 4, 5},
+		{"0o78", "0o78", "invalid digit '8' in octal literal", 3, 4},
+		{"0xfg", "0xfg", "invalid digit 'g' in hexadecimal literal", 3, 4},
+		{"1__000", "1__000", "'_' must separate successive digits", 2, 3},
+		{"1000_", "1000_", "'_' must separate successive digits", 4, 5},
+		{"0x_", "0x_", "'_' must separate successive digits", 2, 3},
+		{"1.5_e3", "1.5_e3", "'_' must separate successive digits", 3, 4},
+		{"010", "010", "leading zero in decimal literal, use 0o for an octal literal", 0, 1},
+		{"08", "08", "leading zero in decimal literal, use 0o for an octal literal", 0, 1},
+		{"0_1", "0_1", "leading zero in decimal literal, use 0o for an octal literal", 0, 1},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != token.ILLEGAL || tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - wrong token. expected=%s %q, got=%s %q",
+				i, token.ILLEGAL, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+
+		errors := l.Errors()
+		if len(errors) != 1 {
+			t.Errorf("tests[%d] - expected 1 error, got=%d (%v)", i, len(errors), errors)
+			continue
+		}
+
+		if errors[0].Code != CodeMalformedNumber || errors[0].Message != tt.expectedMessage {
+			t.Errorf("tests[%d] - wrong error. expected=%s %q, got=%s %q",
+				i, CodeMalformedNumber, tt.expectedMessage, errors[0].Code, errors[0].Message)
+		}
+
+		span := errors[0].Span
+		if span.Start.Offset != tt.expectedStart || span.End.Offset != tt.expectedEnd {
+			t.Errorf("tests[%d] - wrong span. expected=%d-%d, got=%d-%d",
+				i, tt.expectedStart, tt.expectedEnd, span.Start.Offset, span.End.Offset)
+		}
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	input := "let café = \"😀 ok\";\nlet 変数1 = café;"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedOffset  int
+		expectedColumn  int
+	}{
+		{token.LET, "let", 0, 1},
+		{token.IDENTIFIER, "café", 4, 5},
+		{token.ASSIGN, "=", 10, 10},
+		{token.STRING, "😀 ok", 12, 12},
+		{token.SEMICOLON, ";", 21, 18},
+		{token.LET, "let", 23, 1},
+		{token.IDENTIFIER, "変数1", 27, 5},
+		{token.ASSIGN, "=", 35, 9},
+		{token.IDENTIFIER, "café", 37, 11},
+		{token.SEMICOLON, ";", 42, 15},
+		{token.EOF, "", 43, 16},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%s %q, got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+
+		if tok.Pos.Offset != tt.expectedOffset || tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - wrong position. expected offset=%d column=%d, got offset=%d column=%d",
+				i, tt.expectedOffset, tt.expectedColumn, tok.Pos.Offset, tok.Pos.Column)
+		}
+	}
+
+	if len(l.Errors()) != 0 {
+		t.Fatalf("unexpected errors: %v", l.Errors())
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	input := "é \xff x \"a\xfeb\" §"
+
+	l := New(input)
+
+	expected := []struct {
+		expectedType    token.TokenType
+		expectedColumn int
+	}{
+		{token.IDENTIFIER, 1},
+		{token.ILLEGAL, 3},
+		{token.IDENTIFIER, 5},
+		{token.STRING, 7},
+		{token.ILLEGAL, 13},
+		{token.EOF, 14},
+	}
+
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - wrong token. expected=%s at column %d, got=%s %q at column %d",
+				i, tt.expectedType, tt.expectedColumn, tok.Type, tok.Literal, tok.Pos.Column)
+		}
+	}
+
+	errors := l.Errors()
+	if len(errors) != 3 {
+		t.Fatalf("expected 3 errors, got=%d (%v)", len(errors), errors)
+	}
+
+	if errors[0].Code != CodeInvalidUTF8 || errors[0].Span.Start.Offset != 3 || errors[0].Span.End.Offset != 4 {
+		t.Errorf("wrong first error. got=%+v", errors[0])
+	}
+
+	if errors[1].Code != CodeInvalidUTF8 || errors[1].Span.Start.Column != 9 {
+		t.Errorf("wrong second error. got=%+v", errors[1])
+	}
+
+	if errors[2].Code != CodeIllegalCharacter || errors[2].Message != `illegal character '§'` {
+		t.Errorf("wrong third error. got=%+v", errors[2])
+	}
+}
+
+func TestNewReaderMatchesNew(t *testing.T) {
+	input := "let café = fn(x) { x * 2.5 };\nlet s = \"snow\\u{2603} \xff\";\ncafé(1e3)[0] != 9"
+
+	expected := New(input)
+	actual := NewReader("stream", iotest.OneByteReader(strings.NewReader(input)))
+
+	for i := 0; ; i++ {
+		want := expected.NextToken()
+		got := actual.NextToken()
+
+		want.Pos.Filename = "stream"
+		want.End.Filename = "stream"
+		if got != want {
+			t.Fatalf("token %d differs. expected=%+v, got=%+v", i, want, got)
+		}
+
+		if got.Type == token.EOF {
+			break
+		}
+	}
+
+	if len(actual.Errors()) != len(expected.Errors()) {
+		t.Fatalf("errors differ. expected=%v, got=%v", expected.Errors(), actual.Errors())
+	}
+}
+
+func TestNewReaderStreamsIncrementally(t *testing.T) {
+	const STATEMENTS = 10000
+
+	reader, writer := io.Pipe()
+	go func() {
+		for i := 0; i < STATEMENTS; i++ {
+			fmt.Fprintf(writer, "let x%d = %d;\n", i, i)
+		}
+		writer.Close()
+	}()
+
+	l := NewReader("pipe", reader)
+
+	count := 0
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if tok.Type == token.LET {
+			count += 1
+		}
+	}
+
+	if count != STATEMENTS {
+		t.Fatalf("wrong number of let statements. expected=%d, got=%d", STATEMENTS, count)
+	}
+}
+
+func TestNewReaderReportsReadErrors(t *testing.T) {
+	failing := io.MultiReader(strings.NewReader("let x"), iotest.ErrReader(errors.New("connection reset")))
+
+	l := NewReader("net", failing)
+
+	tests := []token.TokenType{token.LET, token.IDENTIFIER, token.EOF, token.EOF}
+	for i, expected := range tests {
+		if tok := l.NextToken(); tok.Type != expected {
+			t.Fatalf("tests[%d] - wrong token. expected=%s, got=%s", i, expected, tok.Type)
+		}
+	}
+
+	errors := l.Errors()
+	if len(errors) != 1 || errors[0].Code != CodeReadError || errors[0].Message != "connection reset" {
+		t.Fatalf("expected a single read error, got=%v", errors)
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading comment
+let x = 1; // trailing comment
+/* block
+   /* nested */ still comment */
+x / 2 /**/ * 3`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.COMMENT, "// leading comment"},
+		{token.LET, "let"},
+		{token.IDENTIFIER, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.COMMENT, "// trailing comment"},
+		{token.COMMENT, "/* block\n   /* nested */ still comment */"},
+		{token.IDENTIFIER, "x"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.COMMENT, "/**/"},
+		{token.ASTERISK, "*"},
+		{token.INT, "3"},
+		{token.EOF, ""},
+	}
+
+	trivia := New(input)
+	trivia.SetMode(ScanComments)
+	skipping := New(input)
+
+	for i, tt := range tests {
+		tok := trivia.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong trivia token. expected=%s %q, got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+
+		if tt.expectedType == token.COMMENT {
+			if tok.End.Offset-tok.Pos.Offset != len(tt.expectedLiteral) {
+				t.Fatalf("tests[%d] - comment span wrong. got=%d..%d", i, tok.Pos.Offset, tok.End.Offset)
+			}
+			continue
+		}
+
+		tok = skipping.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%s %q, got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+
+	if len(trivia.Errors()) != 0 || len(skipping.Errors()) != 0 {
+		t.Fatalf("unexpected errors: %v %v", trivia.Errors(), skipping.Errors())
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	l := New("1 /* outer /* inner */")
+
+	if tok := l.NextToken(); tok.Type != token.INT {
+		t.Fatalf("expected INT, got=%s", tok.Type)
+	}
+
+	if tok := l.NextToken(); tok.Type != token.EOF {
+		t.Fatalf("expected EOF, got=%s %q", tok.Type, tok.Literal)
+	}
+
+	errors := l.Errors()
+	if len(errors) != 1 || errors[0].Code != CodeUnterminatedComment {
+		t.Fatalf("expected an unterminated comment error, got=%v", errors)
+	}
+
+	if errors[0].Span.Start.Offset != 2 || errors[0].Span.End.Offset != 22 {
+		t.Errorf("wrong span. got=%d..%d", errors[0].Span.Start.Offset, errors[0].Span.End.Offset)
+	}
+
+	if len(errors[0].Fixes) != 1 || errors[0].Fixes[0].Replacement != "*/" {
+		t.Errorf("wrong fix. got=%+v", errors[0].Fixes)
+	}
+}
+
+func TestNulIsNotEndOfInput(t *testing.T) {
+	l := New("let x = 1;\x00 let y = \"a\x00b\";")
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENTIFIER, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.ILLEGAL, "\x00"},
+		{token.LET, "let"},
+		{token.IDENTIFIER, "y"},
+		{token.ASSIGN, "="},
+		{token.STRING, "a\x00b"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%s %q, got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+
+	errors := l.Errors()
+	if len(errors) != 1 || errors[0].Code != CodeIllegalCharacter || errors[0].Span.Start.Offset != 10 {
+		t.Fatalf("expected a single illegal character error at offset 10, got=%v", errors)
+	}
+}
@@ -0,0 +1,49 @@
+package object
+
+// holds the bindings created by let statements. Function calls get their own
+// environment enclosed by the one the function was defined in, which the
+// function captured when it was created, so a closure keeps seeing the
+// variables around its definition after that scope has returned
+type Environment struct {
+	store map[string]Object
+	outer *Environment
+}
+
+func NewEnvironment() *Environment {
+	return &Environment{store: make(map[string]Object)}
+}
+
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	return env
+}
+
+// looks name up in this environment and then in the enclosing ones
+func (env *Environment) Get(name string) (Object, bool) {
+	object, ok := env.store[name]
+	if !ok && env.outer != nil {
+		object, ok = env.outer.Get(name)
+	}
+	return object, ok
+}
+
+// binds name in this environment, shadowing any binding of the same name in
+// an enclosing one. Used by let, parameters and loop variables
+func (env *Environment) Define(name string, value Object) Object {
+	env.store[name] = value
+	return value
+}
+
+// updates name in the innermost environment that already binds it, rather
+// than shadowing it in this one, so that a closure can change a variable it
+// captured. Reports false if name is not bound anywhere
+func (env *Environment) Set(name string, value Object) bool {
+	for scope := env; scope != nil; scope = scope.outer {
+		if _, ok := scope.store[name]; ok {
+			scope.store[name] = value
+			return true
+		}
+	}
+	return false
+}
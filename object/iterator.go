@@ -0,0 +1,99 @@
+package object
+
+import "unicode/utf8"
+
+// implemented by every object a for-in loop can walk over
+type Iterable interface {
+	Object
+	Iterate() Iterator
+}
+
+// produces the elements of an Iterable one at a time. Key is the position of
+// the element for arrays, strings and ranges, and the key for hashes
+type Iterator interface {
+	Next() (key, value Object, ok bool)
+}
+
+type arrayIterator struct {
+	array *Array
+	index int
+}
+
+// sees elements assigned during the loop, but not past the length the array
+// has when each step is taken
+func (a *Array) Iterate() Iterator { return &arrayIterator{array: a} }
+
+func (it *arrayIterator) Next() (Object, Object, bool) {
+	if it.index >= len(it.array.Elements) {
+		return nil, nil, false
+	}
+	key := &Integer{Value: int64(it.index)}
+	value := it.array.Elements[it.index]
+	it.index += 1
+	return key, value, true
+}
+
+// walks a string one rune at a time, so the position counts runes rather
+// than bytes
+type stringIterator struct {
+	text   string
+	offset int
+	index  int64
+}
+
+func (s *String) Iterate() Iterator { return &stringIterator{text: s.Value} }
+
+func (it *stringIterator) Next() (Object, Object, bool) {
+	if it.offset >= len(it.text) {
+		return nil, nil, false
+	}
+	r, width := utf8.DecodeRuneInString(it.text[it.offset:])
+	key := &Integer{Value: it.index}
+	it.offset += width
+	it.index += 1
+	return key, &String{Value: string(r)}, true
+}
+
+// visits pairs in insertion order, including any added during the loop
+type hashIterator struct {
+	hash  *Hash
+	index int
+}
+
+func (h *Hash) Iterate() Iterator { return &hashIterator{hash: h} }
+
+func (it *hashIterator) Next() (Object, Object, bool) {
+	if it.index >= len(it.hash.keys) {
+		return nil, nil, false
+	}
+	pair := it.hash.pairs[it.hash.keys[it.index]]
+	it.index += 1
+	return pair.Key, pair.Value, true
+}
+
+type rangeIterator struct {
+	r     *Range
+	next  int64
+	index int64
+	done  bool
+}
+
+func (r *Range) Iterate() Iterator { return &rangeIterator{r: r, next: r.From} }
+
+func (it *rangeIterator) Next() (Object, Object, bool) {
+	if it.done || it.next > it.r.To || it.next == it.r.To && !it.r.Inclusive {
+		return nil, nil, false
+	}
+
+	key := &Integer{Value: it.index}
+	value := &Integer{Value: it.next}
+
+	// stop rather than overflow when an inclusive range ends at the
+	// largest integer
+	if it.next == it.r.To {
+		it.done = true
+	}
+	it.next += 1
+	it.index += 1
+	return key, value, true
+}
@@ -0,0 +1,277 @@
+package object
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/gavwyh/go-interpreter/ast"
+	"github.com/gavwyh/go-interpreter/code"
+)
+
+type ObjectType string
+
+const (
+	INTEGER_OBJ      = "INTEGER"
+	BIGINT_OBJ       = "BIGINT"
+	FLOAT_OBJ        = "FLOAT"
+	STRING_OBJ       = "STRING"
+	BOOLEAN_OBJ      = "BOOLEAN"
+	NULL_OBJ         = "NULL"
+	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	TAIL_CALL_OBJ    = "TAIL_CALL"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
+	ERROR_OBJ        = "ERROR"
+	FUNCTION_OBJ     = "FUNCTION"
+	BUILTIN_OBJ      = "BUILTIN"
+	ARRAY_OBJ        = "ARRAY"
+	HASH_OBJ         = "HASH"
+	RANGE_OBJ        = "RANGE"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	CELL_OBJ              = "CELL"
+)
+
+// every value produced by the evaluator implements Object
+type Object interface {
+	Type() ObjectType
+	Inspect() string
+}
+
+type Integer struct {
+	Value int64
+}
+
+// an integer too large for an int64. Arithmetic produces one only when the
+// result overflows, and goes back to an Integer once the value fits again,
+// so the same number is never both
+type BigInt struct {
+	Value *big.Int
+}
+
+type Float struct {
+	Value float64
+}
+
+type String struct {
+	Value string
+}
+
+type Boolean struct {
+	Value bool
+}
+
+type Null struct{}
+
+// wraps the value of a return statement so that it can bubble up
+// through nested block statements
+type ReturnValue struct {
+	Value Object
+}
+
+// a call in tail position that has not been made yet. The evaluator hands it
+// back to the function call it would have returned from, which makes it in
+// place of its own body, so tail recursion does not grow the Go stack
+type TailCall struct {
+	Function  Object
+	Arguments []Object
+}
+
+// produced by break and continue statements, and like ReturnValue they stop
+// every block they pass through until they reach the enclosing loop
+type Break struct{}
+
+type Continue struct{}
+
+type Error struct {
+	Message string
+}
+
+type Function struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+// the bytecode of a function literal, as it sits in the constant pool. The vm
+// only ever calls it wrapped in a Closure
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+
+	// by slot, for reporting a variable that is read before it is set
+	LocalNames []string
+	FreeNames  []string
+}
+
+// a compiled function together with the variables it captured from the
+// functions around it, each shared through a Cell. It is the vm's
+// equivalent of a Function, so it has the same type
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []*Cell
+}
+
+// a variable shared between a function and the closures it created, so that
+// an assignment through one of them is seen by all
+type Cell struct {
+	Value Object
+}
+
+// a function provided by the interpreter rather than written in the language
+type BuiltinFunction func(arguments ...Object) Object
+
+type Builtin struct {
+	Name string
+	Fn   BuiltinFunction
+}
+
+type Array struct {
+	Elements []Object
+}
+
+// the integers from From up to To, including To only if Inclusive. The
+// numbers are produced one at a time when iterated, never stored
+type Range struct {
+	From      int64
+	To        int64
+	Inclusive bool
+}
+
+func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
+func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
+
+func (b *BigInt) Type() ObjectType { return BIGINT_OBJ }
+func (b *BigInt) Inspect() string  { return b.Value.String() }
+
+// returns an Integer if value fits in an int64 and a BigInt otherwise
+func NewInteger(value *big.Int) Object {
+	if value.IsInt64() {
+		return &Integer{Value: value.Int64()}
+	}
+	return &BigInt{Value: value}
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
+// always shows a fraction or exponent, so that 3.0 is not mistaken for 3
+func (f *Float) Inspect() string {
+	text := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(text, ".eIN") {
+		text += ".0"
+	}
+	return text
+}
+
+func (s *String) Type() ObjectType { return STRING_OBJ }
+func (s *String) Inspect() string  { return s.Value }
+
+func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
+func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
+
+func (n *Null) Type() ObjectType { return NULL_OBJ }
+func (n *Null) Inspect() string  { return "null" }
+
+func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
+func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
+
+func (tc *TailCall) Type() ObjectType { return TAIL_CALL_OBJ }
+func (tc *TailCall) Inspect() string  { return "tail call of " + tc.Function.Inspect() }
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
+func (e *Error) Type() ObjectType { return ERROR_OBJ }
+func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+
+func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+
+func (f *Function) Inspect() string {
+	var out strings.Builder
+
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(f.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string  { return fmt.Sprintf("CompiledFunction[%p]", cf) }
+
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string  { return fmt.Sprintf("Closure[%p]", c) }
+
+func (c *Cell) Type() ObjectType { return CELL_OBJ }
+
+// a cell is empty until the variable is first set
+func (c *Cell) Inspect() string {
+	if c.Value == nil {
+		return "cell"
+	}
+	return "cell " + c.Value.Inspect()
+}
+
+func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+func (b *Builtin) Inspect() string  { return "builtin " + b.Name }
+
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+
+func (r *Range) Inspect() string {
+	if r.Inclusive {
+		return fmt.Sprintf("%d..=%d", r.From, r.To)
+	}
+	return fmt.Sprintf("%d..%d", r.From, r.To)
+}
+
+func (a *Array) Type() ObjectType { return ARRAY_OBJ }
+
+func (a *Array) Inspect() string { return a.inspect(map[Object]bool{}) }
+
+// seen holds the arrays and hashes being inspected further up, so that one
+// which contains itself, e.g after a[0] = a, prints as [...] instead of
+// recursing forever
+func (a *Array) inspect(seen map[Object]bool) string {
+	if seen[a] {
+		return "[...]"
+	}
+	seen[a] = true
+	defer delete(seen, a)
+
+	var out strings.Builder
+
+	elements := []string{}
+	for _, e := range a.Elements {
+		elements = append(elements, inspectElement(e, seen))
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+func inspectElement(obj Object, seen map[Object]bool) string {
+	switch obj := obj.(type) {
+	case *Array:
+		return obj.inspect(seen)
+	case *Hash:
+		return obj.inspect(seen)
+	default:
+		return obj.Inspect()
+	}
+}
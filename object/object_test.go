@@ -0,0 +1,131 @@
+package object
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestStringHashKey(t *testing.T) {
+	hello1 := &String{Value: "Hello World"}
+	hello2 := &String{Value: "Hello World"}
+	diff1 := &String{Value: "My name is johnny"}
+	diff2 := &String{Value: "My name is johnny"}
+
+	if hello1.HashKey() != hello2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if diff1.HashKey() != diff2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if hello1.HashKey() == diff1.HashKey() {
+		t.Errorf("strings with different content have same hash keys")
+	}
+}
+
+func TestHashKeysDistinguishTypes(t *testing.T) {
+	one := &Integer{Value: 1}
+	yes := &Boolean{Value: true}
+	text := &String{Value: "1"}
+
+	if one.HashKey() == yes.HashKey() || one.HashKey() == text.HashKey() {
+		t.Errorf("objects of different types share a hash key")
+	}
+}
+
+func TestNewIntegerDemotes(t *testing.T) {
+	small := NewInteger(big.NewInt(42))
+	if integer, ok := small.(*Integer); !ok || integer.Value != 42 {
+		t.Errorf("expected Integer 42. got=%T (%+v)", small, small)
+	}
+
+	huge, _ := new(big.Int).SetString("18446744073709551616", 10)
+	large := NewInteger(huge)
+	if _, ok := large.(*BigInt); !ok || large.Inspect() != "18446744073709551616" {
+		t.Errorf("expected BigInt 18446744073709551616. got=%T (%+v)", large, large)
+	}
+
+	again, _ := new(big.Int).SetString("18446744073709551616", 10)
+	if large.(*BigInt).HashKey() != (&BigInt{Value: again}).HashKey() {
+		t.Errorf("big integers with the same value have different hash keys")
+	}
+}
+
+func TestEnvironmentSetUpdatesDefiningScope(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Define("x", &Integer{Value: 1})
+	inner := NewEnclosedEnvironment(outer)
+
+	if !inner.Set("x", &Integer{Value: 2}) {
+		t.Fatalf("Set did not find x in the outer environment")
+	}
+
+	if value, _ := outer.Get("x"); value.(*Integer).Value != 2 {
+		t.Errorf("outer x not updated. got=%s", value.Inspect())
+	}
+
+	if _, ok := inner.store["x"]; ok {
+		t.Errorf("Set shadowed x in the inner environment")
+	}
+
+	if inner.Set("y", &Integer{Value: 3}) {
+		t.Errorf("Set succeeded for an unbound name")
+	}
+}
+
+func TestInclusiveRangeEndingAtMaxInt64(t *testing.T) {
+	r := &Range{From: math.MaxInt64 - 1, To: math.MaxInt64, Inclusive: true}
+
+	var values []int64
+	iterator := r.Iterate()
+	for {
+		_, value, ok := iterator.Next()
+		if !ok {
+			break
+		}
+		values = append(values, value.(*Integer).Value)
+		if len(values) > 2 {
+			t.Fatalf("range did not stop. got=%v", values)
+		}
+	}
+
+	if len(values) != 2 || values[1] != math.MaxInt64 {
+		t.Errorf("wrong values. got=%v", values)
+	}
+}
+
+func TestHashKeepsInsertionOrder(t *testing.T) {
+	hash := NewHash()
+	hash.Set(&String{Value: "b"}, &Integer{Value: 1})
+	hash.Set(&Integer{Value: 2}, &Integer{Value: 2})
+	hash.Set(&String{Value: "b"}, &Integer{Value: 3})
+	hash.Set(&Boolean{Value: true}, &Integer{Value: 4})
+
+	if hash.Len() != 3 {
+		t.Fatalf("hash has wrong length. got=%d", hash.Len())
+	}
+
+	expected := `{"b": 3, 2: 2, true: 4}`
+	if hash.Inspect() != expected {
+		t.Errorf("hash.Inspect() wrong. expected=%q, got=%q", expected, hash.Inspect())
+	}
+}
+
+func TestInspectCycles(t *testing.T) {
+	array := &Array{Elements: []Object{&Integer{Value: 1}}}
+	hash := NewHash()
+	hash.Set(&String{Value: "a"}, array)
+	array.Elements = append(array.Elements, array, hash)
+
+	expected := `[1, [...], {"a": [...]}]`
+	if array.Inspect() != expected {
+		t.Errorf("array.Inspect() wrong. expected=%q, got=%q", expected, array.Inspect())
+	}
+
+	expected = `{"a": [1, [...], {...}]}`
+	if hash.Inspect() != expected {
+		t.Errorf("hash.Inspect() wrong. expected=%q, got=%q", expected, hash.Inspect())
+	}
+}
@@ -1,43 +1,104 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
+	"sort"
 	"strconv"
 
 	"github.com/gavwyh/go-interpreter/token"
 	"github.com/gavwyh/go-interpreter/lexer"
 	"github.com/gavwyh/go-interpreter/ast"
+	"github.com/gavwyh/go-interpreter/diagnostic"
+)
+
+// diagnostic codes reported by the parser
+const (
+	CodeUnexpectedToken = "P0001"
+	CodeNoPrefixParseFn = "P0002"
+	CodeInvalidInteger = "P0003"
+	CodeInvalidFloat = "P0004"
+	CodeInvalidAssignment = "P0005"
+	CodeOutsideLoop = "P0006"
 )
 
 const (
 	_ int = iota
 	LOWEST
+	ASSIGNMENT // =, +=, -=, *= or /=
+	RANGE // .. or ..=
+	LOGICAL_OR // ||
+	LOGICAL_AND // &&
 	EQUALS // ==
-	LESSGREATER // > or <
+	LESSGREATER // >, <, >= or <=
+	BITWISE_OR // |
+	BITWISE_XOR // ^
+	BITWISE_AND // &
+	SHIFT // << or >>
 	SUM // +
-	PRODUCT // *
-	PREFIX // -X or !X
+	PRODUCT // *, / or %
+	PREFIX // -X, !X or ~X
 	CALL // myFunction(X)
+	INDEX // array[index]
 )
 
 var precedences = map[token.TokenType]int{
+	token.ASSIGN: ASSIGNMENT,
+	token.PLUS_ASSIGN: ASSIGNMENT,
+	token.MINUS_ASSIGN: ASSIGNMENT,
+	token.ASTERISK_ASSIGN: ASSIGNMENT,
+	token.SLASH_ASSIGN: ASSIGNMENT,
+	token.DOTDOT: RANGE,
+	token.DOTDOT_EQ: RANGE,
 	token.EQ: EQUALS,
 	token.NOT_EQ: EQUALS,
 	token.LT: LESSGREATER,
 	token.GT: LESSGREATER,
+	token.LT_EQ: LESSGREATER,
+	token.GT_EQ: LESSGREATER,
+	token.AND: LOGICAL_AND,
+	token.OR: LOGICAL_OR,
+	token.PIPE: BITWISE_OR,
+	token.CARET: BITWISE_XOR,
+	token.AMPERSAND: BITWISE_AND,
+	token.SHIFT_LEFT: SHIFT,
+	token.SHIFT_RIGHT: SHIFT,
 	token.PLUS: SUM,
 	token.MINUS: SUM,
 	token.SLASH: PRODUCT,
 	token.ASTERISK: PRODUCT,
+	token.PERCENT: PRODUCT,
+	token.LPAREN: CALL,
+	token.LBRACKET: INDEX,
 }
 
 type Parser struct {
 	lexer *lexer.Lexer
-	errors []string
+	errors []diagnostic.Diagnostic
+
+	// set by the first error in a statement and cleared once the parser has
+	// skipped to the next statement, so that one mistake is only reported once
+	panicking bool
+	statementStart token.Token
 
+	// the `{` up to the current token that are still open, and how many of
+	// them start the blocks being parsed. Any others belong to an expression
+	// such as a hash literal, which synchronise has to skip to the end of
+	openBraces int
+	blockDepth int
+
+	// number of loops enclosing the current token within the current
+	// function, so that break and continue elsewhere can be rejected
+	loopDepth int
+
+	prevToken token.Token
 	curToken token.Token
 	peekToken token.Token
 
+	// a token handed back by backup, returned before asking the lexer again
+	pushedBack *token.Token
+
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns map[token.TokenType]infixParseFn
 }
@@ -51,7 +112,7 @@ type (
 func New(lexer *lexer.Lexer) *Parser {
 	parser := &Parser{
 		lexer : lexer,
-		errors: []string{},
+		errors: []diagnostic.Diagnostic{},
 	}
 
 	// Read two tokens to set both curToken & peekToken -> required to determine if 
@@ -62,13 +123,20 @@ func New(lexer *lexer.Lexer) *Parser {
 	parser.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	parser.registerPrefix(token.IDENTIFIER, parser.parseIdentifier)
 	parser.registerPrefix(token.INT, parser.parseIntegerLiteral)
+	parser.registerPrefix(token.FLOAT, parser.parseFloatLiteral)
+	parser.registerPrefix(token.STRING, parser.parseStringLiteral)
 	parser.registerPrefix(token.BANG, parser.parsePrefixExpression)
 	parser.registerPrefix(token.MINUS, parser.parsePrefixExpression)
+	parser.registerPrefix(token.TILDE, parser.parsePrefixExpression)
 	parser.registerPrefix(token.TRUE, parser.parseBoolean)
 	parser.registerPrefix(token.FALSE, parser.parseBoolean)
 	parser.registerPrefix(token.LPAREN, parser.parseGroupedExpression)
 	parser.registerPrefix(token.IF, parser.parseIfExpression)
 	parser.registerPrefix(token.FUNCTION, parser.parseFunctionLiteral)
+	parser.registerPrefix(token.LBRACKET, parser.parseArrayLiteral)
+	// blocks are only ever parsed directly by the constructs that own them
+	// (if, fn), so a `{` that starts an expression is always a hash
+	parser.registerPrefix(token.LBRACE, parser.parseHashLiteral)
 
 	parser.infixParseFns = make(map[token.TokenType]infixParseFn)
 	parser.registerInfix(token.PLUS, parser.parseInfixExpression)
@@ -79,23 +147,106 @@ func New(lexer *lexer.Lexer) *Parser {
 	parser.registerInfix(token.NOT_EQ, parser.parseInfixExpression)
 	parser.registerInfix(token.LT, parser.parseInfixExpression)
 	parser.registerInfix(token.GT, parser.parseInfixExpression)
+	parser.registerInfix(token.LT_EQ, parser.parseInfixExpression)
+	parser.registerInfix(token.GT_EQ, parser.parseInfixExpression)
+	parser.registerInfix(token.PERCENT, parser.parseInfixExpression)
+	parser.registerInfix(token.AND, parser.parseInfixExpression)
+	parser.registerInfix(token.OR, parser.parseInfixExpression)
+	parser.registerInfix(token.PIPE, parser.parseInfixExpression)
+	parser.registerInfix(token.CARET, parser.parseInfixExpression)
+	parser.registerInfix(token.AMPERSAND, parser.parseInfixExpression)
+	parser.registerInfix(token.SHIFT_LEFT, parser.parseInfixExpression)
+	parser.registerInfix(token.SHIFT_RIGHT, parser.parseInfixExpression)
+	parser.registerInfix(token.ASSIGN, parser.parseAssignExpression)
+	parser.registerInfix(token.PLUS_ASSIGN, parser.parseAssignExpression)
+	parser.registerInfix(token.MINUS_ASSIGN, parser.parseAssignExpression)
+	parser.registerInfix(token.ASTERISK_ASSIGN, parser.parseAssignExpression)
+	parser.registerInfix(token.SLASH_ASSIGN, parser.parseAssignExpression)
+	parser.registerInfix(token.DOTDOT, parser.parseRangeExpression)
+	parser.registerInfix(token.DOTDOT_EQ, parser.parseRangeExpression)
+	parser.registerInfix(token.LPAREN, parser.parseCallExpression)
+	parser.registerInfix(token.LBRACKET, parser.parseIndexExpression)
 
 	return parser
 }
 
-func (parser *Parser) Errors() []string {
-	return parser.errors
+// every diagnostic from both the lexer and the parser, in source order
+func (parser *Parser) Errors() []diagnostic.Diagnostic {
+	lexerErrors := parser.lexer.Errors()
+	if len(lexerErrors) == 0 {
+		return parser.errors
+	}
+
+	errors := make([]diagnostic.Diagnostic, 0, len(lexerErrors)+len(parser.errors))
+	errors = append(errors, lexerErrors...)
+	errors = append(errors, parser.errors...)
+	sort.SliceStable(errors, func(i, j int) bool {
+		return errors[i].Span.Start.Offset < errors[j].Span.Start.Offset
+	})
+	return errors
 }
 
 func (parser *Parser) addError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got=%s",
-			t, parser.peekToken.Type)
-	parser.errors = append(parser.errors, msg)
+	d := diagnostic.Errorf(CodeUnexpectedToken, diagnostic.SpanOf(parser.peekToken),
+		"expected next token to be %s, got=%s", t, parser.peekToken.Type)
+
+	// punctuation can be suggested verbatim, unlike IDENTIFIER or INT
+	if isPunctuation(t) {
+		insertAt := parser.curToken.End
+		d = d.WithFix(diagnostic.Fix{
+			Message: fmt.Sprintf("insert `%s`", t),
+			Span: diagnostic.Span{Start: insertAt, End: insertAt},
+			Replacement: string(t),
+		})
+	}
+
+	parser.report(d)
+}
+
+// records d unless the parser is still recovering from an earlier error
+func (parser *Parser) report(d diagnostic.Diagnostic) {
+	if parser.panicking {
+		return
+	}
+	parser.panicking = true
+	parser.errors = append(parser.errors, d)
 }
 	
 func (parser *Parser) nextToken() {
+	parser.prevToken = parser.curToken
 	parser.curToken = parser.peekToken
+	parser.countBraces(1)
+
+	if parser.pushedBack != nil {
+		parser.peekToken = *parser.pushedBack
+		parser.pushedBack = nil
+		return
+	}
+
+	// comments only reach the parser when the lexer keeps them for other tools
 	parser.peekToken = parser.lexer.NextToken()
+	for parser.peekToken.Type == token.COMMENT {
+		parser.peekToken = parser.lexer.NextToken()
+	}
+}
+
+// keeps openBraces up to date as the current token moves forward, with
+// direction 1, or back, with -1
+func (parser *Parser) countBraces(direction int) {
+	if parser.isCurToken(token.LBRACE) {
+		parser.openBraces += direction
+	} else if parser.isCurToken(token.RBRACE) {
+		parser.openBraces -= direction
+	}
+}
+
+// steps back a single token. Only one step is remembered
+func (parser *Parser) backup() {
+	parser.countBraces(-1)
+	peek := parser.peekToken
+	parser.pushedBack = &peek
+	parser.peekToken = parser.curToken
+	parser.curToken = parser.prevToken
 }
 
 func (parser *Parser) ParseProgram() *ast.Program {
@@ -113,14 +264,89 @@ func (parser *Parser) ParseProgram() *ast.Program {
 }
 
 func (parser *Parser) parseStatement() ast.Statement {
+	start := parser.curToken
+	var statement ast.Statement
+
+	// restored on the way out as statements nest inside blocks
+	outerStart := parser.statementStart
+	parser.statementStart = start
+	defer func() { parser.statementStart = outerStart }()
+
 	switch parser.curToken.Type {
 	case token.LET:
-		return parser.parseLetStatement()
+		if letStatement := parser.parseLetStatement(); letStatement != nil {
+			statement = letStatement
+		}
 	case token.RETURN:
-		return parser.parseReturnStatement()
+		statement = parser.parseReturnStatement()
+	case token.WHILE:
+		if whileStatement := parser.parseWhileStatement(); whileStatement != nil {
+			statement = whileStatement
+		}
+	case token.FOR:
+		statement = parser.parseForStatement()
+	case token.BREAK, token.CONTINUE:
+		statement = parser.parseLoopControlStatement()
 	default:
-		return parser.parseExpressionStatement()
+		statement = parser.parseExpressionStatement()
+	}
+
+	if parser.panicking {
+		parser.synchronise()
+		parser.panicking = false
+	}
+
+	if statement == nil {
+		return &ast.BadStatement{Token: start, To: parser.curToken.End}
+	}
+	return statement
+}
+
+// skips ahead to the next statement boundary after an error, leaving the
+// current token on a `;` or on the last token before a `}` or a keyword
+// such as `let` that starts a statement, so that the caller's nextToken
+// starts a fresh statement.
+// Braces opened while skipping are skipped up to their matching `}`, as are
+// those of an unfinished expression such as the hash literal in `{ x }`
+func (parser *Parser) synchronise() {
+	depth := 0
+	if parser.openBraces > parser.blockDepth {
+		depth = parser.openBraces - parser.blockDepth
+	}
+
+	for !parser.isCurToken(token.EOF) {
+		if depth == 0 {
+			if parser.isCurToken(token.SEMICOLON) {
+				return
+			}
+
+			// a stray `}` is a statement of its own
+			if parser.isCurToken(token.RBRACE) && parser.curToken.Pos == parser.statementStart.Pos {
+				return
+			}
+
+			if isStatementBoundary(parser.peekToken.Type) || parser.isPeekToken(token.EOF) {
+				return
+			}
+		}
+
+		parser.nextToken()
+
+		if parser.isCurToken(token.LBRACE) {
+			depth += 1
+		} else if parser.isCurToken(token.RBRACE) && depth > 0 {
+			depth -= 1
+		}
+	}
+}
+
+// tokens that close the enclosing block or start a new statement
+func isStatementBoundary(tokenType token.TokenType) bool {
+	switch tokenType {
+	case token.RBRACE, token.LET, token.RETURN, token.WHILE, token.FOR, token.BREAK, token.CONTINUE:
+		return true
 	}
+	return false
 }
 
 func (parser *Parser) parseIdentifier() ast.Expression {
@@ -144,7 +370,11 @@ func (parser *Parser) parseLetStatement() *ast.LetStatement {
 		return nil;
 	}
 
-	for !parser.isCurToken(token.SEMICOLON) {
+	parser.nextToken()
+
+	statement.Value = parser.parseExpression(LOWEST)
+
+	if parser.isPeekToken(token.SEMICOLON) {
 		parser.nextToken()
 	}
 	return statement;
@@ -153,9 +383,172 @@ func (parser *Parser) parseLetStatement() *ast.LetStatement {
 func (parser *Parser) parseReturnStatement() *ast.ReturnStatement {
 	statement := &ast.ReturnStatement{Token: parser.curToken}
 
+	// a bare `return;` has no value and evaluates to null
+	if parser.isPeekToken(token.SEMICOLON) || parser.isPeekToken(token.RBRACE) ||
+		parser.isPeekToken(token.EOF) {
+		if parser.isPeekToken(token.SEMICOLON) {
+			parser.nextToken()
+		}
+		return statement
+	}
+
+	parser.nextToken()
+
+	statement.ReturnValue = parser.parseExpression(LOWEST)
+
+	if parser.isPeekToken(token.SEMICOLON) {
+		parser.nextToken()
+	}
+	return statement
+}
+
+func (parser *Parser) parseWhileStatement() *ast.WhileStatement {
+	statement := &ast.WhileStatement{Token: parser.curToken}
+
+	if !parser.peekExpected(token.LPAREN) {
+		return nil
+	}
+
+	parser.nextToken()
+	statement.Condition = parser.parseExpression(LOWEST)
+
+	if !parser.peekExpected(token.RPAREN) {
+		return nil
+	}
+
+	if !parser.peekExpected(token.LBRACE) {
+		return nil
+	}
+
+	statement.Body = parser.parseLoopBody()
+
+	if parser.isPeekToken(token.SEMICOLON) {
+		parser.nextToken()
+	}
+	return statement
+}
+
+// parses either a C-style for loop or a for-in loop, which starts with one
+// or two identifiers followed by `in`
+func (parser *Parser) parseForStatement() ast.Statement {
+	statement := &ast.ForStatement{Token: parser.curToken}
+
+	if !parser.peekExpected(token.LPAREN) {
+		return nil
+	}
+
+	parser.nextToken()
+
+	if parser.isCurToken(token.IDENTIFIER) && (parser.isPeekToken(token.IN) || parser.isPeekToken(token.COMMA)) {
+		return parser.parseForInStatement(statement.Token)
+	}
+
+	// the let or expression statement may already have consumed the `;`
+	if !parser.isCurToken(token.SEMICOLON) {
+		if parser.isCurToken(token.LET) {
+			letStatement := parser.parseLetStatement()
+			if letStatement == nil {
+				return nil
+			}
+			statement.Init = letStatement
+		} else {
+			statement.Init = parser.parseExpressionStatement()
+		}
+
+		if !parser.isCurToken(token.SEMICOLON) && !parser.peekExpected(token.SEMICOLON) {
+			return nil
+		}
+	}
+
+	parser.nextToken()
+	if !parser.isCurToken(token.SEMICOLON) {
+		statement.Condition = parser.parseExpression(LOWEST)
+		if !parser.peekExpected(token.SEMICOLON) {
+			return nil
+		}
+	}
+
+	parser.nextToken()
+	if !parser.isCurToken(token.RPAREN) {
+		statement.Step = parser.parseExpression(LOWEST)
+		if !parser.peekExpected(token.RPAREN) {
+			return nil
+		}
+	}
+
+	if !parser.peekExpected(token.LBRACE) {
+		return nil
+	}
+
+	statement.Body = parser.parseLoopBody()
+
+	if parser.isPeekToken(token.SEMICOLON) {
+		parser.nextToken()
+	}
+	return statement
+}
+
+// parses the rest of a for-in loop starting at its first variable
+func (parser *Parser) parseForInStatement(start token.Token) ast.Statement {
+	statement := &ast.ForInStatement{Token: start}
+	statement.Value = &ast.Identifier{Token: parser.curToken, Value: parser.curToken.Literal}
+
+	if parser.isPeekToken(token.COMMA) {
+		parser.nextToken()
+		if !parser.peekExpected(token.IDENTIFIER) {
+			return nil
+		}
+		statement.Key = statement.Value
+		statement.Value = &ast.Identifier{Token: parser.curToken, Value: parser.curToken.Literal}
+	}
+
+	if !parser.peekExpected(token.IN) {
+		return nil
+	}
+
 	parser.nextToken()
+	statement.Iterable = parser.parseExpression(LOWEST)
+
+	if !parser.peekExpected(token.RPAREN) {
+		return nil
+	}
+
+	if !parser.peekExpected(token.LBRACE) {
+		return nil
+	}
+
+	statement.Body = parser.parseLoopBody()
+
+	if parser.isPeekToken(token.SEMICOLON) {
+		parser.nextToken()
+	}
+	return statement
+}
+
+func (parser *Parser) parseLoopBody() *ast.BlockStatement {
+	parser.loopDepth += 1
+	defer func() { parser.loopDepth -= 1 }()
+
+	return parser.parseBlockStatement()
+}
+
+// parses break or continue, which are only allowed inside a loop in the
+// same function
+func (parser *Parser) parseLoopControlStatement() ast.Statement {
+	var statement ast.Statement
+	if parser.isCurToken(token.BREAK) {
+		statement = &ast.BreakStatement{Token: parser.curToken}
+	} else {
+		statement = &ast.ContinueStatement{Token: parser.curToken}
+	}
+
+	if parser.loopDepth == 0 {
+		d := diagnostic.Errorf(CodeOutsideLoop, diagnostic.SpanOf(parser.curToken),
+			"%s is not inside a loop", parser.curToken.Literal)
+		parser.report(d)
+	}
 
-	for !parser.isCurToken(token.SEMICOLON) {
+	if parser.isPeekToken(token.SEMICOLON) {
 		parser.nextToken()
 	}
 	return statement
@@ -165,6 +558,9 @@ func (parser *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: parser.curToken}
 	block.Statements = []ast.Statement{}
 
+	parser.blockDepth += 1
+	defer func() { parser.blockDepth -= 1 }()
+
 	parser.nextToken()
 
 	for !parser.isCurToken(token.RBRACE) && !parser.isCurToken(token.EOF) {
@@ -174,6 +570,10 @@ func (parser *Parser) parseBlockStatement() *ast.BlockStatement {
 		}
 		parser.nextToken()
 	}
+
+	if parser.isCurToken(token.RBRACE) {
+		block.Rbrace = parser.curToken
+	}
 	return block
 }
 
@@ -193,7 +593,15 @@ func (parser *Parser) parseExpression(precedence int) ast.Expression {
 	prefix := parser.prefixParseFns[parser.curToken.Type]
 	if prefix == nil {
 		parser.noPrefixParseFnError(parser.curToken.Type)
-		return nil
+		bad := parser.badExpression(parser.curToken)
+
+		// a missing operand such as `{ let x = }`: the token belongs to
+		// whatever comes next, so hand it back
+		if isStatementBoundary(parser.curToken.Type) &&
+			parser.curToken.Pos != parser.statementStart.Pos {
+			parser.backup()
+		}
+		return bad
 	}
 	leftExpression := prefix()
 
@@ -218,30 +626,65 @@ func (parser *Parser) parseIntegerLiteral() ast.Expression {
 
 	value, err := strconv.ParseInt(parser.curToken.Literal, MIN_BIT, MAX_BITS)
 
+	if errors.Is(err, strconv.ErrRange) {
+		if bigValue, ok := new(big.Int).SetString(parser.curToken.Literal, MIN_BIT); ok {
+			literal.Big = bigValue
+			return literal
+		}
+	}
+
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as an integer", parser.curToken.Literal)
-		parser.errors = append(parser.errors, msg)
-		return nil
+		d := diagnostic.Errorf(CodeInvalidInteger, diagnostic.SpanOf(parser.curToken),
+			"could not parse %q as an integer", parser.curToken.Literal)
+		parser.report(d)
+		return parser.badExpression(literal.Token)
 	}
 
 	literal.Value = value
 	return literal
 }
 
+func (parser *Parser) parseFloatLiteral() ast.Expression {
+	literal := &ast.FloatLiteral{Token: parser.curToken}
+
+	value, err := strconv.ParseFloat(parser.curToken.Literal, 64)
+
+	if err != nil {
+		d := diagnostic.Errorf(CodeInvalidFloat, diagnostic.SpanOf(parser.curToken),
+			"could not parse %q as a float", parser.curToken.Literal)
+		parser.report(d)
+		return parser.badExpression(literal.Token)
+	}
+
+	literal.Value = value
+	return literal
+}
+
+func (parser *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: parser.curToken, Value: parser.curToken.Literal}
+}
+
 func (parser *Parser) parseFunctionLiteral() ast.Expression {
 	literal := &ast.FunctionLiteral{Token: parser.curToken}
 
 	if !parser.peekExpected(token.LPAREN) {
-		return nil
+		return parser.badExpression(literal.Token)
 	}
 
 	literal.Parameters = parser.parseFunctionParameters()
+	if literal.Parameters == nil {
+		return parser.badExpression(literal.Token)
+	}
 
 	if !parser.peekExpected(token.LBRACE) {
-		return nil
+		return parser.badExpression(literal.Token)
 	}
 
+	// a loop around the function literal does not make break valid inside it
+	outerDepth := parser.loopDepth
+	parser.loopDepth = 0
 	literal.Body = parser.parseBlockStatement()
+	parser.loopDepth = outerDepth
 
 	return literal
 }
@@ -279,18 +722,18 @@ func (parser *Parser) parseIfExpression() ast.Expression {
 	expression := &ast.IfExpression{Token: parser.curToken}
 
 	if !parser.peekExpected(token.LPAREN) {
-		return nil
+		return parser.badExpression(expression.Token)
 	}
 
 	parser.nextToken()
 	expression.Condition = parser.parseExpression(LOWEST)
 
 	if !parser.peekExpected(token.RPAREN) {
-		return nil
+		return parser.badExpression(expression.Token)
 	}
 
 	if !parser.peekExpected(token.LBRACE) {
-		return nil
+		return parser.badExpression(expression.Token)
 	}
 
 	expression.Consequence = parser.parseBlockStatement()
@@ -302,7 +745,7 @@ func (parser *Parser) parseIfExpression() ast.Expression {
 	parser.nextToken()
 
 	if !parser.peekExpected(token.LBRACE) {
-		return nil
+		return parser.badExpression(expression.Token)
 	}
 	expression.Alternative = parser.parseBlockStatement()
 
@@ -335,18 +778,157 @@ func (parser *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+func (parser *Parser) parseRangeExpression(from ast.Expression) ast.Expression {
+	expression := &ast.RangeExpression{
+		Token: parser.curToken,
+		From: from,
+		Inclusive: parser.isCurToken(token.DOTDOT_EQ),
+	}
+
+	parser.nextToken()
+	expression.To = parser.parseExpression(RANGE)
+
+	return expression
+}
+
+// assignment is right associative, so a = b = 1 assigns 1 to both
+func (parser *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		Token: parser.curToken,
+		Target: target,
+		Operator: parser.curToken.Literal,
+	}
+
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	case *ast.BadExpression:
+		// already reported
+	default:
+		d := diagnostic.Errorf(CodeInvalidAssignment, diagnostic.Span{Start: target.Pos(), End: target.End()},
+			"cannot assign to %s", target.String()).
+			WithNote("only variables and index expressions such as xs[0] can be assigned to")
+		parser.report(d)
+	}
+
+	parser.nextToken()
+	expression.Value = parser.parseExpression(ASSIGNMENT - 1)
+
+	return expression
+}
+
+func (parser *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+	expression := &ast.CallExpression{Token: parser.curToken, Function: function}
+	expression.Arguments = parser.parseExpressionList(token.RPAREN)
+	if expression.Arguments == nil {
+		return parser.badExpression(expression.Token)
+	}
+
+	expression.Rparen = parser.curToken
+	return expression
+}
+
+// parses a comma separated list of expressions up to end, as found in call
+// arguments and array literals. A trailing comma is allowed e.g add(1, 2,).
+// The list is nil if it is not closed by end
+func (parser *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	list := []ast.Expression{}
+
+	if parser.isPeekToken(end) {
+		parser.nextToken()
+		return list
+	}
+
+	parser.nextToken()
+	list = append(list, parser.parseExpression(LOWEST))
+
+	for parser.isPeekToken(token.COMMA) {
+		parser.nextToken()
+
+		if parser.isPeekToken(end) {
+			break
+		}
+
+		parser.nextToken()
+		list = append(list, parser.parseExpression(LOWEST))
+	}
+
+	if !parser.peekExpected(end) {
+		return nil
+	}
+
+	return list
+}
+
+func (parser *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: parser.curToken}
+	array.Elements = parser.parseExpressionList(token.RBRACKET)
+	if array.Elements == nil {
+		return parser.badExpression(array.Token)
+	}
+
+	array.Rbracket = parser.curToken
+	return array
+}
+
+func (parser *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: parser.curToken, Pairs: []ast.HashPair{}}
+
+	for !parser.isPeekToken(token.RBRACE) {
+		parser.nextToken()
+		key := parser.parseExpression(LOWEST)
+
+		if !parser.peekExpected(token.COLON) {
+			return parser.badExpression(hash.Token)
+		}
+
+		parser.nextToken()
+		value := parser.parseExpression(LOWEST)
+
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+
+		// a trailing comma is allowed e.g {"a": 1,}
+		if !parser.isPeekToken(token.RBRACE) && !parser.peekExpected(token.COMMA) {
+			return parser.badExpression(hash.Token)
+		}
+	}
+
+	parser.nextToken()
+	hash.Rbrace = parser.curToken
+	return hash
+}
+
+func (parser *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	expression := &ast.IndexExpression{Token: parser.curToken, Left: left}
+
+	parser.nextToken()
+	expression.Index = parser.parseExpression(LOWEST)
+
+	if !parser.peekExpected(token.RBRACKET) {
+		return parser.badExpression(expression.Token)
+	}
+
+	expression.Rbracket = parser.curToken
+	return expression
+}
+
 func (parser *Parser) parseGroupedExpression() ast.Expression {
+	lparen := parser.curToken
 	parser.nextToken()
 
 	expression := parser.parseExpression(LOWEST)
 
 	if !parser.peekExpected(token.RPAREN) {
-		return nil
+		return parser.badExpression(lparen)
 	}
 
 	return expression
 }
 
+// a placeholder for an expression starting at start that could not be parsed
+func (parser *Parser) badExpression(start token.Token) *ast.BadExpression {
+	return &ast.BadExpression{Token: start, To: parser.curToken.End}
+}
+
 func (parser *Parser) isCurToken(tokenType token.TokenType) bool { 
 	return parser.curToken.Type == tokenType 
 }
@@ -373,8 +955,25 @@ func (parser *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn)
 }
 
 func (parser *Parser) noPrefixParseFnError(tokenType token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", tokenType)
-	parser.errors = append(parser.errors, msg)
+	// the lexer has already reported why the token is illegal
+	if tokenType == token.ILLEGAL {
+		parser.panicking = true
+		return
+	}
+
+	d := diagnostic.Errorf(CodeNoPrefixParseFn, diagnostic.SpanOf(parser.curToken),
+		"no prefix parse function for %s found", tokenType)
+	if tokenType == token.EOF {
+		d = d.WithNote("the input ended in the middle of an expression")
+	} else {
+		d = d.WithNote("%q cannot start an expression", parser.curToken.Literal)
+	}
+	parser.report(d)
+}
+
+func isPunctuation(tokenType token.TokenType) bool {
+	ch := tokenType[0]
+	return !('A' <= ch && ch <= 'Z')
 }
 
 func (parser *Parser) peekPrecedence() int {
@@ -101,6 +101,114 @@ func TestOperatorPrecendenceParsing(t *testing.T) {
 			"!(true == true)",
 			"(!(true == true))",
 		},
+		{
+			"a + add(b * c) + d",
+			"((a + add((b * c))) + d)",
+		},
+		{
+			"add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))",
+			"add(a, b, 1, (2 * 3), (4 + 5), add(6, (7 * 8)))",
+		},
+		{
+			"add(a + b + c * d / f + g)",
+			"add((((a + b) + ((c * d) / f)) + g))",
+		},
+		{
+			"add(1, 2,)",
+			"add(1, 2)",
+		},
+		{
+			"fn(x) { x }(5)",
+			"fn(x) x(5)",
+		},
+		{
+			"-add(1)(2)",
+			"(-add(1)(2))",
+		},
+		{
+			"a * [1, 2, 3, 4][b * c] * d",
+			"((a * ([1, 2, 3, 4][(b * c)])) * d)",
+		},
+		{
+			"add(a * b[2], b[1], 2 * [1, 2][1])",
+			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
+		},
+		{
+			"fns[0](1)",
+			"(fns[0])(1)",
+		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"a == b && c != d",
+			"((a == b) && (c != d))",
+		},
+		{
+			"a <= b == c >= d",
+			"((a <= b) == (c >= d))",
+		},
+		{
+			"a + b % c * d",
+			"(a + ((b % c) * d))",
+		},
+		{
+			"!a || -b <= c",
+			"((!a) || ((-b) <= c))",
+		},
+		{
+			"a | b ^ c & d",
+			"(a | (b ^ (c & d)))",
+		},
+		{
+			"a & b == c | d",
+			"((a & b) == (c | d))",
+		},
+		{
+			"a << b < c >> d",
+			"((a << b) < (c >> d))",
+		},
+		{
+			"a + b << c * d",
+			"((a + b) << (c * d))",
+		},
+		{
+			"~a & -b",
+			"((~a) & (-b))",
+		},
+		{
+			"a & b && c | d",
+			"((a & b) && (c | d))",
+		},
+		{
+			"x = y = 1 + 2",
+			"(x = (y = (1 + 2)))",
+		},
+		{
+			"x += a || b",
+			"(x += (a || b))",
+		},
+		{
+			"xs[i + 1] *= 2",
+			"((xs[(i + 1)]) *= 2)",
+		},
+		{
+			"0..n + 1",
+			"(0..(n + 1))",
+		},
+		{
+			"a || b..=c && d",
+			"((a || b)..=(c && d))",
+		},
+		{
+			"r = 0..10",
+			"(r = (0..10))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -116,38 +224,70 @@ func TestOperatorPrecendenceParsing(t *testing.T) {
 	}
 }
 func TestLetStatements(t *testing.T) {
-	const SENTENCES = 3
-	input := `
-	let x = 5;
-	let y = 10;
-	let foobar = 838383;
-	`
+	tests := []struct {
+		input              string
+		expectedIdentifier string
+		expectedValue      interface{}
+	}{
+		{"let x = 5;", "x", 5},
+		{"let y = true;", "y", true},
+		{"let foobar = y;", "foobar", "y"},
+		{"let z = 1 + 2", "z", nil},
+	}
 
-	l := lexer.New(input)
-	parser := New(l)
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		parser := New(l)
+		program := parser.ParseProgram()
+		checkParserErrors(t, parser)
 
-	program := parser.ParseProgram()
-	checkParserErrors(t, parser)
-	if program == nil {
-		t.Fatalf("ParseProgram() returned nil")
-	}
-	if len(program.Statements) != SENTENCES {
-		t.Fatalf("program.Statements does not contain %d statements. got=%d",
-			SENTENCES, len(program.Statements))
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+
+		statement := program.Statements[0]
+		if !testLetStatement(t, statement, tt.expectedIdentifier) {
+			return
+		}
+
+		value := statement.(*ast.LetStatement).Value
+		if tt.expectedValue == nil {
+			testInfixExpression(t, value, 1, "+", 2)
+			continue
+		}
+		if !testLiteralExpression(t, value, tt.expectedValue) {
+			return
+		}
 	}
+}
 
+func TestLetAndReturnErrors(t *testing.T) {
 	tests := []struct {
-		expectedIdentifier string
+		input         string
+		expectedError string
 	}{
-		{"x"},
-		{"y"},
-		{"foobar"},
+		{"let x = ;", "no prefix parse function for ; found"},
+		{"let x 5;", "expected next token to be =, got=INT"},
+		{"let = 5;", "expected next token to be IDENTIFIER, got=="},
+		{"let x =", "no prefix parse function for EOF found"},
+		{"return *;", "no prefix parse function for * found"},
 	}
 
-	for i, tt := range tests {
-		statement := program.Statements[i]
-		if !testLetStatement(t, statement, tt.expectedIdentifier) {
-			return
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		parser := New(l)
+		parser.ParseProgram()
+
+		errors := parser.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q, got none", tt.input)
+			continue
+		}
+
+		if errors[0].Message != tt.expectedError {
+			t.Errorf("wrong first error for %q. expected=%q, got=%q",
+				tt.input, tt.expectedError, errors[0].Message)
 		}
 	}
 }
@@ -344,37 +484,47 @@ func TestIfElseExpression(t *testing.T) {
 }
 
 func TestReturnStatements(t *testing.T) {
-	const SENTENCES = 3
-	input := `
-	return x = 5;
-	return y = 10;
-	return 838383;
-	`
-
-	l := lexer.New(input)
-	parser := New(l)
-
-	program := parser.ParseProgram()
-	checkParserErrors(t, parser)
-	if program == nil {
-		t.Fatalf("ParseProgram() returned nil")
+	tests := []struct {
+		input         string
+		expectedValue interface{}
+	}{
+		{"return 5;", 5},
+		{"return true;", true},
+		{"return foobar", "foobar"},
+		{"return;", nil},
 	}
 
-	if len(program.Statements) != SENTENCES {
-		t.Fatalf("program.Statements does not contain %d statements. got=%d",
-			SENTENCES, len(program.Statements))
-	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		parser := New(l)
+		program := parser.ParseProgram()
+		checkParserErrors(t, parser)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
 
-	for _, statement := range program.Statements {
-		returnStatement, ok := statement.(*ast.ReturnStatement)
+		returnStatement, ok := program.Statements[0].(*ast.ReturnStatement)
 		if !ok {
-			t.Errorf("statement is not of type *ast.ReturnStatement, got=%T", statement)
-			continue
+			t.Fatalf("statement is not of type *ast.ReturnStatement, got=%T",
+				program.Statements[0])
 		}
 		if returnStatement.TokenLiteral() != "return" {
 			t.Errorf("returnStatement.TokenLiteral not 'return', got %q",
 				returnStatement.TokenLiteral())
 		}
+
+		if tt.expectedValue == nil {
+			if returnStatement.ReturnValue != nil {
+				t.Errorf("returnStatement.ReturnValue not nil. got=%s",
+					returnStatement.ReturnValue)
+			}
+			continue
+		}
+		if !testLiteralExpression(t, returnStatement.ReturnValue, tt.expectedValue) {
+			return
+		}
 	}
 }
 
@@ -477,6 +627,175 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestExtendedIntegerLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0x1F", 31},
+		{"0o755", 493},
+		{"0b1010", 10},
+		{"1_000_000", 1000000},
+		{"0xFFFF_FFFF", 4294967295},
+		{"0x7fffffffffffffff", 9223372036854775807},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		parser := New(l)
+		program := parser.ParseProgram()
+		checkParserErrors(t, parser)
+
+		statement := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := statement.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", statement.Expression)
+		}
+
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %d. got=%d", tt.expected, literal.Value)
+		}
+
+		if literal.String() != tt.input {
+			t.Errorf("literal.String() does not keep the spelling %q. got=%q", tt.input, literal.String())
+		}
+	}
+}
+
+func TestBigIntegerLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775808", "9223372036854775808"},
+		{"0x1_0000_0000_0000_0000", "18446744073709551616"},
+		{"123456789012345678901234567890", "123456789012345678901234567890"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		parser := New(l)
+		program := parser.ParseProgram()
+		checkParserErrors(t, parser)
+
+		statement := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := statement.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", statement.Expression)
+		}
+
+		if literal.Big == nil || literal.Big.String() != tt.expected {
+			t.Errorf("literal.Big not %s. got=%v", tt.expected, literal.Big)
+		}
+
+		if literal.String() != tt.input {
+			t.Errorf("literal.String() does not keep the spelling %q. got=%q", tt.input, literal.String())
+		}
+	}
+}
+
+func TestIntegerLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedCode    string
+		expectedMessage string
+	}{
+		{"09", lexer.CodeMalformedNumber, "leading zero in decimal literal, use 0o for an octal literal"},
+		{"010 + 1", lexer.CodeMalformedNumber, "leading zero in decimal literal, use 0o for an octal literal"},
+		{"let x = 0b102;", lexer.CodeMalformedNumber, "invalid digit '2' in binary literal"},
+		{"0x + 1", lexer.CodeMalformedNumber, "hexadecimal literal has no digits"},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.input)
+		parser := New(l)
+		parser.ParseProgram()
+
+		errors := parser.Errors()
+		if len(errors) != 1 {
+			t.Errorf("tests[%d] - expected 1 error, got=%d (%v)", i, len(errors), errors)
+			continue
+		}
+
+		if errors[0].Code != tt.expectedCode || errors[0].Message != tt.expectedMessage {
+			t.Errorf("tests[%d] - wrong error. expected=%s %q, got=%s %q",
+				i, tt.expectedCode, tt.expectedMessage, errors[0].Code, errors[0].Message)
+		}
+	}
+}
+
+func TestStringLiteralExpression(t *testing.T) {
+	input := `"hello\tworld";`
+
+	l := lexer.New(input)
+	parser := New(l)
+	program := parser.ParseProgram()
+	checkParserErrors(t, parser)
+
+	statement := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := statement.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.StringLiteral. got=%T", statement.Expression)
+	}
+
+	if literal.Value != "hello\tworld" {
+		t.Errorf("literal.Value not %q. got=%q", "hello\tworld", literal.Value)
+	}
+
+	if literal.String() != `"hello\tworld"` {
+		t.Errorf("literal.String() does not round trip. got=%s", literal.String())
+	}
+}
+
+func TestLexerErrorsAreReportedOnce(t *testing.T) {
+	input := "let s = \"abc\nlet y = @;\nlet z = 1;"
+
+	l := lexer.New(input)
+	parser := New(l)
+	program := parser.ParseProgram()
+
+	errors := parser.Errors()
+	if len(errors) != 2 {
+		t.Fatalf("expected 2 errors, got=%d (%v)", len(errors), errors)
+	}
+
+	if errors[0].Code != lexer.CodeUnterminatedString || errors[1].Code != lexer.CodeIllegalCharacter {
+		t.Errorf("wrong errors. got=%v", errors)
+	}
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("expected 3 statements, got=%d (%q)", len(program.Statements), program.String())
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{".5", 0.5},
+		{"1e-9", 1e-9},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		parser := New(l)
+		program := parser.ParseProgram()
+		checkParserErrors(t, parser)
+
+		statement := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := statement.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", statement.Expression)
+		}
+
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+		}
+	}
+}
+
 func testIntegerLiteral(t *testing.T, il ast.Expression, value int64) bool {
 	integerLiteral, ok := il.(*ast.IntegerLiteral)
 
@@ -575,23 +894,223 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
-func TestParsingPrefixExpressions(t *testing.T) {
-	const SENTENCES = 1
+func TestCallExpressionParsing(t *testing.T) {
+	input := "add(1, 2 * 3, 4 + 5);"
 
-	prefixTests := []struct {
-		input    string
-		operator string
-		value    interface{}
-	}{
-		{"!5;", "!", 5},
-		{"-15;", "-", 15},
-		{"!true;", "!", true},
-		{"!false;", "!", false},
+	l := lexer.New(input)
+	parser := New(l)
+	program := parser.ParseProgram()
+	checkParserErrors(t, parser)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
 	}
 
-	for _, tt := range prefixTests {
-		l := lexer.New(tt.input)
-		parser := New(l)
+	statement, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("statement is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	expression, ok := statement.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("statement.Expression is not ast.CallExpression. got=%T",
+			statement.Expression)
+	}
+
+	if !testIdentifier(t, expression.Function, "add") {
+		return
+	}
+
+	if len(expression.Arguments) != 3 {
+		t.Fatalf("wrong length of arguments. got=%d", len(expression.Arguments))
+	}
+
+	testLiteralExpression(t, expression.Arguments[0], 1)
+	testInfixExpression(t, expression.Arguments[1], 2, "*", 3)
+	testInfixExpression(t, expression.Arguments[2], 4, "+", 5)
+}
+
+func TestParsingArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3, fn(x) { x },]"
+
+	l := lexer.New(input)
+	parser := New(l)
+	program := parser.ParseProgram()
+	checkParserErrors(t, parser)
+
+	statement, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("statement is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	array, ok := statement.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", statement.Expression)
+	}
+
+	if len(array.Elements) != 4 {
+		t.Fatalf("len(array.Elements) not 4. got=%d", len(array.Elements))
+	}
+
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+
+	if _, ok := array.Elements[3].(*ast.FunctionLiteral); !ok {
+		t.Errorf("array.Elements[3] not ast.FunctionLiteral. got=%T", array.Elements[3])
+	}
+
+	if array.End().Offset != len(input) {
+		t.Errorf("array does not end at the closing bracket. got=%d", array.End().Offset)
+	}
+}
+
+func TestParsingEmptyArrayLiterals(t *testing.T) {
+	l := lexer.New("[]")
+	parser := New(l)
+	program := parser.ParseProgram()
+	checkParserErrors(t, parser)
+
+	statement := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := statement.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", statement.Expression)
+	}
+
+	if len(array.Elements) != 0 {
+		t.Errorf("len(array.Elements) not 0. got=%d", len(array.Elements))
+	}
+}
+
+func TestParsingHashLiterals(t *testing.T) {
+	input := `{"one": 1, "two": 2, "three": 3}`
+
+	l := lexer.New(input)
+	parser := New(l)
+	program := parser.ParseProgram()
+	checkParserErrors(t, parser)
+
+	statement := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := statement.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", statement.Expression)
+	}
+
+	expected := []struct {
+		key   string
+		value int64
+	}{
+		{"one", 1},
+		{"two", 2},
+		{"three", 3},
+	}
+
+	if len(hash.Pairs) != len(expected) {
+		t.Fatalf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	for i, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("key is not ast.StringLiteral. got=%T", pair.Key)
+			continue
+		}
+
+		if literal.Value != expected[i].key {
+			t.Errorf("pairs[%d] has wrong key. expected=%q, got=%q", i, expected[i].key, literal.Value)
+		}
+
+		testIntegerLiteral(t, pair.Value, expected[i].value)
+	}
+}
+
+func TestParsingEmptyHashLiteral(t *testing.T) {
+	l := lexer.New("{}")
+	parser := New(l)
+	program := parser.ParseProgram()
+	checkParserErrors(t, parser)
+
+	statement := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := statement.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", statement.Expression)
+	}
+
+	if len(hash.Pairs) != 0 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+}
+
+func TestParsingHashLiteralsWithExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"one": 0 + 1, "two": 10 - 8,}`, `{"one": (0 + 1), "two": (10 - 8)}`},
+		{`{1: true, true: fn(x) { x }}`, `{1: true, true: fn(x) x}`},
+		{`let h = {"a": {"b": 1}}; h["a"]["b"]`, `let h = {"a": {"b": 1}};((h["a"])["b"])`},
+		{`if (x) { {"a": 1} }`, `ifx {"a": 1}`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		parser := New(l)
+		program := parser.ParseProgram()
+		checkParserErrors(t, parser)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestParsingIndexExpressions(t *testing.T) {
+	input := "myArray[1 + 1]"
+
+	l := lexer.New(input)
+	parser := New(l)
+	program := parser.ParseProgram()
+	checkParserErrors(t, parser)
+
+	statement, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("statement is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	indexExpression, ok := statement.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", statement.Expression)
+	}
+
+	if !testIdentifier(t, indexExpression.Left, "myArray") {
+		return
+	}
+
+	if !testInfixExpression(t, indexExpression.Index, 1, "+", 1) {
+		return
+	}
+}
+
+func TestParsingPrefixExpressions(t *testing.T) {
+	const SENTENCES = 1
+
+	prefixTests := []struct {
+		input    string
+		operator string
+		value    interface{}
+	}{
+		{"!5;", "!", 5},
+		{"-15;", "-", 15},
+		{"~15;", "~", 15},
+		{"!true;", "!", true},
+		{"!false;", "!", false},
+	}
+
+	for _, tt := range prefixTests {
+		l := lexer.New(tt.input)
+		parser := New(l)
 		program := parser.ParseProgram()
 		checkParserErrors(t, parser)
 
@@ -639,6 +1158,16 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"true && false;", true, "&&", false},
+		{"true || false;", true, "||", false},
+		{"5 & 5;", 5, "&", 5},
+		{"5 | 5;", 5, "|", 5},
+		{"5 ^ 5;", 5, "^", 5},
+		{"5 << 5;", 5, "<<", 5},
+		{"5 >> 5;", 5, ">>", 5},
 		{"true == true;", true, "==", true},
 		{"true != false;", true, "!=", false},
 		{"false == false;", false, "==", false},
@@ -718,7 +1247,479 @@ func checkParserErrors(t *testing.T, parser *Parser) {
 	}
 
 	for _, msg := range errors {
-		t.Errorf("parser error: %q", msg)
+		t.Errorf("parser error: %q", msg.Message)
 	}
 	t.Fatalf("parser has %d errors", len(errors))
 }
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedTarget   string
+		expectedOperator string
+		expectedValue    string
+	}{
+		{"x = 5;", "x", "=", "5"},
+		{"x += 1", "x", "+=", "1"},
+		{"x -= y", "x", "-=", "y"},
+		{"x *= 2;", "x", "*=", "2"},
+		{"x /= 2;", "x", "/=", "2"},
+		{"xs[0] = true", "(xs[0])", "=", "true"},
+		{`h["a"] += 1`, `(h["a"])`, "+=", "1"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		parser := New(l)
+		program := parser.ParseProgram()
+		checkParserErrors(t, parser)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+
+		statement := program.Statements[0].(*ast.ExpressionStatement)
+		assign, ok := statement.Expression.(*ast.AssignExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.AssignExpression. got=%T", statement.Expression)
+		}
+
+		if assign.Target.String() != tt.expectedTarget {
+			t.Errorf("assign.Target not %s. got=%s", tt.expectedTarget, assign.Target.String())
+		}
+
+		if assign.Operator != tt.expectedOperator {
+			t.Errorf("assign.Operator not %s. got=%s", tt.expectedOperator, assign.Operator)
+		}
+
+		if assign.Value.String() != tt.expectedValue {
+			t.Errorf("assign.Value not %s. got=%s", tt.expectedValue, assign.Value.String())
+		}
+	}
+}
+
+func TestInvalidAssignmentTargets(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"1 = 2", "cannot assign to 1"},
+		{"f() += 1", "cannot assign to f()"},
+		{"a + b = c", "cannot assign to (a + b)"},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.input)
+		parser := New(l)
+		parser.ParseProgram()
+
+		errors := parser.Errors()
+		if len(errors) != 1 {
+			t.Errorf("tests[%d] - expected 1 error, got=%d (%v)", i, len(errors), errors)
+			continue
+		}
+
+		if errors[0].Code != CodeInvalidAssignment || errors[0].Message != tt.expectedMessage {
+			t.Errorf("tests[%d] - wrong error. expected=%s %q, got=%s %q",
+				i, CodeInvalidAssignment, tt.expectedMessage, errors[0].Code, errors[0].Message)
+		}
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	input := "let add = fn(x, y) {\n  x + y;\n};\nadd(1, 2)"
+
+	l := lexer.New(input)
+	parser := New(l)
+	program := parser.ParseProgram()
+	checkParserErrors(t, parser)
+
+	letStatement := program.Statements[0].(*ast.LetStatement)
+	function := letStatement.Value.(*ast.FunctionLiteral)
+	body := function.Body.Statements[0].(*ast.ExpressionStatement)
+	call := program.Statements[1].(*ast.ExpressionStatement).Expression
+
+	tests := []struct {
+		node          ast.Node
+		expectedStart string
+		expectedEnd   string
+	}{
+		{program, "1:1", "4:10"},
+		{letStatement, "1:1", "3:2"},
+		{function, "1:11", "3:2"},
+		{body.Expression, "2:3", "2:8"},
+		{call, "4:1", "4:10"},
+	}
+
+	for i, tt := range tests {
+		if tt.node.Pos().String() != tt.expectedStart {
+			t.Errorf("tests[%d] %q wrong start. expected=%s, got=%s",
+				i, tt.node.String(), tt.expectedStart, tt.node.Pos())
+		}
+		if tt.node.End().String() != tt.expectedEnd {
+			t.Errorf("tests[%d] %q wrong end. expected=%s, got=%s",
+				i, tt.node.String(), tt.expectedEnd, tt.node.End())
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	input := "let x = 1;\nadd(1, 2"
+
+	l := lexer.NewFile("main.mk", input)
+	parser := New(l)
+	parser.ParseProgram()
+
+	errors := parser.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("expected 1 error, got=%d (%v)", len(errors), errors)
+	}
+
+	d := errors[0]
+	if d.Code != CodeUnexpectedToken {
+		t.Errorf("wrong code. expected=%s, got=%s", CodeUnexpectedToken, d.Code)
+	}
+
+	if d.Error() != "main.mk:2:9: error[P0001]: expected next token to be ), got=EOF" {
+		t.Errorf("wrong error string. got=%q", d.Error())
+	}
+
+	if len(d.Fixes) != 1 || d.Fixes[0].Replacement != ")" || d.Fixes[0].Span.Start.Column != 9 {
+		t.Errorf("wrong fix-it. got=%+v", d.Fixes)
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedError      string
+		expectedStatements []string
+	}{
+		{
+			"let x = ;\nlet y = 2;",
+			"no prefix parse function for ; found",
+			[]string{"let x = <bad expression>;", "let y = 2;"},
+		},
+		{
+			"let = 5;\nlet y = 2;",
+			"expected next token to be IDENTIFIER, got==",
+			[]string{"<bad statement>", "let y = 2;"},
+		},
+		{
+			"let x = let y = 2;",
+			"no prefix parse function for LET found",
+			[]string{"let x = <bad expression>;", "let y = 2;"},
+		},
+		{
+			"let f = fn() { let x = }; let y = 1;",
+			"no prefix parse function for } found",
+			[]string{"let f = fn() let x = <bad expression>;;", "let y = 1;"},
+		},
+		{
+			"let f = fn(x { x }; let y = 2;",
+			"expected next token to be ), got={",
+			[]string{"let f = <bad expression>;", "let y = 2;"},
+		},
+		{
+			"add(1, 2\nreturn 3",
+			"expected next token to be ), got=RETURN",
+			[]string{"<bad expression>", "return 3;"},
+		},
+		{
+			"[1, 2 3]; 4",
+			"expected next token to be ], got=INT",
+			[]string{"<bad expression>", "4"},
+		},
+		{
+			"{ x }; let y = 1;",
+			"expected next token to be :, got=}",
+			[]string{"<bad expression>", "let y = 1;"},
+		},
+		{
+			"fn() { let h = { x }; h }; 1",
+			"expected next token to be :, got=}",
+			[]string{"fn() let h = <bad expression>;h", "1"},
+		},
+		{
+			"} 1 + 2",
+			"no prefix parse function for } found",
+			[]string{"<bad expression>", "(1 + 2)"},
+		},
+		{
+			"if ((1 + 2) { 3 } else { 4 }; 5",
+			"expected next token to be ), got={",
+			[]string{"<bad expression>", "5"},
+		},
+		{
+			"while (x { x }; let y = 2;",
+			"expected next token to be ), got={",
+			[]string{"<bad statement>", "let y = 2;"},
+		},
+		{
+			"for (let i = 0; i < 3 { i }\nlet y = 2;",
+			"expected next token to be ;, got={",
+			[]string{"<bad statement>", "let y = 2;"},
+		},
+		{
+			"for (k, 1 in h) { k }; let y = 2;",
+			"expected next token to be IDENTIFIER, got=INT",
+			[]string{"<bad statement>", "let y = 2;"},
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		parser := New(l)
+		program := parser.ParseProgram()
+
+		errors := parser.Errors()
+		if len(errors) != 1 {
+			t.Errorf("expected 1 error for %q, got=%d (%v)", tt.input, len(errors), errors)
+			continue
+		}
+
+		if errors[0].Message != tt.expectedError {
+			t.Errorf("wrong error for %q. expected=%q, got=%q",
+				tt.input, tt.expectedError, errors[0].Message)
+		}
+
+		if len(program.Statements) != len(tt.expectedStatements) {
+			t.Errorf("wrong number of statements for %q. expected=%d, got=%d (%q)",
+				tt.input, len(tt.expectedStatements), len(program.Statements), program.String())
+			continue
+		}
+
+		for i, expected := range tt.expectedStatements {
+			if actual := program.Statements[i].String(); actual != expected {
+				t.Errorf("wrong statement %d for %q. expected=%q, got=%q",
+					i, tt.input, expected, actual)
+			}
+		}
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	input := "while (x < 10) { x += 1; }"
+
+	l := lexer.New(input)
+	parser := New(l)
+	program := parser.ParseProgram()
+	checkParserErrors(t, parser)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	statement, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.WhileStatement. got=%T", program.Statements[0])
+	}
+
+	if !testInfixExpression(t, statement.Condition, "x", "<", 10) {
+		return
+	}
+
+	if len(statement.Body.Statements) != 1 {
+		t.Fatalf("body is not 1 statement. got=%d", len(statement.Body.Statements))
+	}
+
+	if statement.Body.String() != "(x += 1)" {
+		t.Errorf("body wrong. got=%s", statement.Body.String())
+	}
+}
+
+func TestForStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for (let i = 0; i < 10; i += 1) { i }", "for (let i = 0; (i < 10); (i += 1)) i"},
+		{"for (i = 0; i < 10; i = i + 1) { i }", "for ((i = 0); (i < 10); (i = (i + 1))) i"},
+		{"for (;;) { break; }", "for (; ; ) break;"},
+		{"for (; x;) { continue }", "for (; x; ) continue;"},
+		{"for (let i = 0;;) {}", "for (let i = 0; ; ) "},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		parser := New(l)
+		program := parser.ParseProgram()
+		checkParserErrors(t, parser)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+
+		statement, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ForStatement. got=%T", program.Statements[0])
+		}
+
+		if statement.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, statement.String())
+		}
+	}
+}
+
+func TestForInStatements(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedKey      string
+		expectedValue    string
+		expectedIterable string
+		expected         string
+	}{
+		{"for (x in xs) { x }", "", "x", "xs", "for (x in xs) x"},
+		{"for (k, v in h) { k }", "k", "v", "h", "for (k, v in h) k"},
+		{"for (i in 0..10) { i }", "", "i", "(0..10)", "for (i in (0..10)) i"},
+		{"for (i in 1..=n) { break; }", "", "i", "(1..=n)", "for (i in (1..=n)) break;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		parser := New(l)
+		program := parser.ParseProgram()
+		checkParserErrors(t, parser)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+
+		statement, ok := program.Statements[0].(*ast.ForInStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ForInStatement. got=%T", program.Statements[0])
+		}
+
+		if tt.expectedKey == "" && statement.Key != nil {
+			t.Errorf("statement.Key not nil. got=%s", statement.Key)
+		}
+		if tt.expectedKey != "" && (statement.Key == nil || statement.Key.Value != tt.expectedKey) {
+			t.Errorf("statement.Key not %s. got=%v", tt.expectedKey, statement.Key)
+		}
+
+		if statement.Value.Value != tt.expectedValue {
+			t.Errorf("statement.Value not %s. got=%s", tt.expectedValue, statement.Value)
+		}
+
+		if statement.Iterable.String() != tt.expectedIterable {
+			t.Errorf("statement.Iterable not %s. got=%s", tt.expectedIterable, statement.Iterable)
+		}
+
+		if statement.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, statement.String())
+		}
+	}
+}
+
+// like let and return, a loop may be followed by a `;`
+func TestLoopTrailingSemicolon(t *testing.T) {
+	tests := []string{
+		"while (i < 3) { i += 1 }; x",
+		"for (let i = 0; i < 3; i += 1) { i }; x",
+		"for (;;) { break; }; x",
+		"for (x in xs) { x }; x",
+		"for (k, v in h) { k }; x",
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		parser := New(l)
+		program := parser.ParseProgram()
+		checkParserErrors(t, parser)
+
+		if len(program.Statements) != 2 {
+			t.Fatalf("program.Statements does not contain 2 statements for %q. got=%d", input, len(program.Statements))
+		}
+
+		statement, ok := program.Statements[1].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[1] is not ast.ExpressionStatement. got=%T", program.Statements[1])
+		}
+		testIdentifier(t, statement.Expression, "x")
+	}
+}
+
+func TestRangeExpression(t *testing.T) {
+	tests := []struct {
+		input             string
+		expectedFrom      interface{}
+		expectedTo        interface{}
+		expectedInclusive bool
+	}{
+		{"0..10", 0, 10, false},
+		{"a..=b", "a", "b", true},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		parser := New(l)
+		program := parser.ParseProgram()
+		checkParserErrors(t, parser)
+
+		statement := program.Statements[0].(*ast.ExpressionStatement)
+		rangeExpression, ok := statement.Expression.(*ast.RangeExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.RangeExpression. got=%T", statement.Expression)
+		}
+
+		testLiteralExpression(t, rangeExpression.From, tt.expectedFrom)
+		testLiteralExpression(t, rangeExpression.To, tt.expectedTo)
+
+		if rangeExpression.Inclusive != tt.expectedInclusive {
+			t.Errorf("rangeExpression.Inclusive not %t. got=%t", tt.expectedInclusive, rangeExpression.Inclusive)
+		}
+	}
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"break;", "break is not inside a loop"},
+		{"if (true) { continue }", "continue is not inside a loop"},
+		{"while (true) { let f = fn() { break; }; }", "break is not inside a loop"},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.input)
+		parser := New(l)
+		parser.ParseProgram()
+
+		errors := parser.Errors()
+		if len(errors) != 1 {
+			t.Errorf("tests[%d] - expected 1 error, got=%d (%v)", i, len(errors), errors)
+			continue
+		}
+
+		if errors[0].Code != CodeOutsideLoop || errors[0].Message != tt.expectedMessage {
+			t.Errorf("tests[%d] - wrong error. expected=%s %q, got=%s %q",
+				i, CodeOutsideLoop, tt.expectedMessage, errors[0].Code, errors[0].Message)
+		}
+	}
+
+	l := lexer.New("while (true) { if (x) { break; } for (;;) { continue; } break; }")
+	parser := New(l)
+	parser.ParseProgram()
+	checkParserErrors(t, parser)
+}
+
+func TestParsingIgnoresComments(t *testing.T) {
+	input := `
+	// adds two numbers
+	let add = fn(x, /* first */ y) {
+		x + y // sum
+	};
+	add(1, 2)`
+
+	l := lexer.New(input)
+	l.SetMode(lexer.ScanComments)
+	parser := New(l)
+	program := parser.ParseProgram()
+	checkParserErrors(t, parser)
+
+	expected := "let add = fn(x, y) (x + y);add(1, 2)"
+	if program.String() != expected {
+		t.Errorf("expected=%q, got=%q", expected, program.String())
+	}
+}
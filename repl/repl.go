@@ -4,28 +4,300 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"github.com/gavwyh/go-interpreter/token"
+	"sort"
+	"strings"
+
+	"github.com/gavwyh/go-interpreter/ast"
+	"github.com/gavwyh/go-interpreter/compiler"
+	"github.com/gavwyh/go-interpreter/diagnostic"
+	"github.com/gavwyh/go-interpreter/evaluator"
 	"github.com/gavwyh/go-interpreter/lexer"
+	"github.com/gavwyh/go-interpreter/object"
+	"github.com/gavwyh/go-interpreter/parser"
+	"github.com/gavwyh/go-interpreter/token"
+	"github.com/gavwyh/go-interpreter/vm"
 )
 
 const PROMPT = ">> "
 
+// what the REPL does with a line that is not a meta-command
+type Mode string
+
+const (
+	TokensMode Mode = "tokens" // print the tokens
+	ASTMode    Mode = "ast"    // print the syntax tree
+	EvalMode   Mode = "eval"   // evaluate with the tree-walking evaluator
+	VMMode     Mode = "vm"     // compile and run on the virtual machine
+)
+
+var modes = []Mode{TokensMode, ASTMode, EvalMode, VMMode}
+
+// a colon-prefixed meta-command such as :tokens. Run receives whatever
+// follows the name on the line, with surrounding spaces removed
+type Command struct {
+	Name  string // without the colon
+	Usage string // the arguments, for :help
+	Help  string
+	Run   func(r *REPL, args string) error
+}
+
+// reads lines from In and writes results to Out until In runs out. Lines
+// starting with a colon are meta-commands, anything else is handled
+// according to the current mode. Variables persist from line to line until
+// :reset
+type REPL struct {
+	In   io.Reader
+	Out  io.Writer
+	Mode Mode
+
+	commands  map[string]*Command
+	lastInput string
+
+	env *object.Environment
+
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+}
+
+func New(in io.Reader, out io.Writer) *REPL {
+	r := &REPL{In: in, Out: out, Mode: EvalMode, commands: make(map[string]*Command)}
+	r.Reset()
+
+	r.Register(Command{Name: "tokens", Usage: "<source>", Help: "print the tokens of source", Run: runTokens})
+	r.Register(Command{Name: "ast", Usage: "<source>", Help: "print the syntax tree of source", Run: runAST})
+	r.Register(Command{Name: "parse", Usage: "<source>", Help: "print source as the parser understood it, fully parenthesised", Run: runParse})
+	r.Register(Command{Name: "errors", Usage: "[source]", Help: "print the diagnostics for source, or for the last line", Run: runErrors})
+	r.Register(Command{Name: "mode", Usage: "[tokens|ast|eval|vm]", Help: "show or change what plain lines do", Run: runMode})
+	r.Register(Command{Name: "reset", Help: "forget every variable", Run: runReset})
+	r.Register(Command{Name: "help", Help: "list the meta-commands", Run: runHelp})
+
+	return r
+}
+
+// runs a REPL in the default mode, reading from in until it is exhausted
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+	New(in, out).Run()
+}
 
-	for {
-		fmt.Fprintf(out, PROMPT)
-		scanned := scanner.Scan()
+// adds a meta-command, replacing any existing one of the same name
+func (r *REPL) Register(command Command) {
+	r.commands[command.Name] = &command
+}
+
+// the registered meta-commands, sorted by name
+func (r *REPL) Commands() []Command {
+	commands := make([]Command, 0, len(r.commands))
+	for _, command := range r.commands {
+		commands = append(commands, *command)
+	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
+	return commands
+}
+
+// throws away every variable, for both the evaluator and the vm
+func (r *REPL) Reset() {
+	r.env = object.NewEnvironment()
 
-		if !scanned {
+	r.symbolTable = compiler.NewSymbolTable()
+	for i, builtin := range evaluator.Builtins {
+		r.symbolTable.DefineBuiltin(i, builtin.Name)
+	}
+	r.constants = []object.Object{}
+	r.globals = make([]object.Object, vm.GlobalsSize)
+}
+
+func (r *REPL) Run() {
+	scanner := bufio.NewScanner(r.In)
+
+	for {
+		fmt.Fprint(r.Out, PROMPT)
+		if !scanner.Scan() {
 			return
 		}
+		r.Execute(scanner.Text())
+	}
+}
+
+// handles one line of input. A panic while doing so, which is a bug in the
+// interpreter, is printed as an error so that the session carries on
+func (r *REPL) Execute(line string) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			fmt.Fprintf(r.Out, "ERROR: %v\n", recovered)
+		}
+	}()
+
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+
+	if !strings.HasPrefix(line, ":") {
+		r.lastInput = line
+		r.runMode(line)
+		return
+	}
+
+	name, args := line[1:], ""
+	if i := strings.IndexAny(name, " \t"); i != -1 {
+		name, args = name[:i], strings.TrimSpace(name[i:])
+	}
+
+	command, ok := r.commands[name]
+	if !ok {
+		fmt.Fprintf(r.Out, "unknown command :%s, try :help\n", name)
+		return
+	}
+
+	if err := command.Run(r, args); err != nil {
+		fmt.Fprintf(r.Out, "%s\n", err)
+	}
+}
+
+func (r *REPL) runMode(line string) {
+	switch r.Mode {
+	case TokensMode:
+		r.printTokens(line)
+	case ASTMode:
+		if program, ok := r.parse(line); ok {
+			ast.Fprint(r.Out, program)
+		}
+	case EvalMode:
+		if program, ok := r.parse(line); ok {
+			r.evaluate(program)
+		}
+	case VMMode:
+		if program, ok := r.parse(line); ok {
+			r.runVM(program)
+		}
+	}
+}
+
+func (r *REPL) printTokens(source string) {
+	l := lexer.New(source)
 
-		line := scanner.Text()
-		l := lexer.New(line)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		fmt.Fprintf(r.Out, "%s %s %q\n", tok.Pos, tok.Type, tok.Literal)
+	}
+	diagnostic.Render(r.Out, source, l.Errors())
+}
+
+// parses source and prints its diagnostics, reporting false if there were
+// any errors
+func (r *REPL) parse(source string) (*ast.Program, bool) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+
+	diagnostics := p.Errors()
+	diagnostic.Render(r.Out, source, diagnostics)
 
-		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
-			fmt.Fprintf(out, "%+v\n", tok)
+	for _, d := range diagnostics {
+		if d.Severity == diagnostic.Error {
+			return program, false
+		}
+	}
+	return program, true
+}
+
+// a statement such as let has no value, and prints nothing
+func (r *REPL) evaluate(program *ast.Program) {
+	evaluated := evaluator.Eval(program, r.env)
+	if evaluated != nil {
+		fmt.Fprintln(r.Out, evaluated.Inspect())
+	}
+}
+
+func (r *REPL) runVM(program *ast.Program) {
+	c := compiler.NewWithState(r.symbolTable, r.constants)
+	if err := c.Compile(program); err != nil {
+		fmt.Fprintf(r.Out, "ERROR: %s\n", err)
+		return
+	}
+
+	bytecode := c.Bytecode()
+	r.constants = bytecode.Constants
+
+	machine := vm.NewWithGlobalsStore(bytecode, r.globals)
+	if err := machine.Run(); err != nil {
+		fmt.Fprintf(r.Out, "ERROR: %s\n", err)
+		return
+	}
+
+	// nil after a let, which like in the evaluator prints nothing
+	if result := machine.LastPoppedStackElem(); result != nil {
+		fmt.Fprintln(r.Out, result.Inspect())
+	}
+}
+
+func runTokens(r *REPL, args string) error {
+	r.printTokens(args)
+	return nil
+}
+
+// shows the tree even when there are errors, so that it is clear where
+// the parser recovered
+func runAST(r *REPL, args string) error {
+	program, _ := r.parse(args)
+	return ast.Fprint(r.Out, program)
+}
+
+func runParse(r *REPL, args string) error {
+	program, _ := r.parse(args)
+	_, err := fmt.Fprintln(r.Out, program.String())
+	return err
+}
+
+func runErrors(r *REPL, args string) error {
+	source := args
+	if source == "" {
+		source = r.lastInput
+	}
+
+	p := parser.New(lexer.New(source))
+	p.ParseProgram()
+
+	diagnostics := p.Errors()
+	if len(diagnostics) == 0 {
+		_, err := fmt.Fprintln(r.Out, "no errors")
+		return err
+	}
+	return diagnostic.Render(r.Out, source, diagnostics)
+}
+
+func runMode(r *REPL, args string) error {
+	if args == "" {
+		_, err := fmt.Fprintf(r.Out, "mode: %s\n", r.Mode)
+		return err
+	}
+
+	for _, mode := range modes {
+		if string(mode) == args {
+			r.Mode = mode
+			return nil
+		}
+	}
+
+	names := make([]string, len(modes))
+	for i, mode := range modes {
+		names[i] = string(mode)
+	}
+	return fmt.Errorf("unknown mode %q, want one of %s", args, strings.Join(names, ", "))
+}
+
+func runReset(r *REPL, args string) error {
+	r.Reset()
+	return nil
+}
+
+func runHelp(r *REPL, args string) error {
+	for _, command := range r.Commands() {
+		usage := ":" + command.Name
+		if command.Usage != "" {
+			usage += " " + command.Usage
+		}
+		if _, err := fmt.Fprintf(r.Out, "%-28s %s\n", usage, command.Help); err != nil {
+			return err
 		}
 	}
-}
\ No newline at end of file
+	return nil
+}
@@ -0,0 +1,133 @@
+package repl
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func run(r *REPL, lines ...string) string {
+	out := r.Out.(*bytes.Buffer)
+	out.Reset()
+	for _, line := range lines {
+		r.Execute(line)
+	}
+	return out.String()
+}
+
+func newTestREPL() *REPL {
+	return New(strings.NewReader(""), &bytes.Buffer{})
+}
+
+func TestEvalModeKeepsVariables(t *testing.T) {
+	r := newTestREPL()
+
+	output := run(r, "let x = 5;", "x * 2")
+	if output != "10\n" {
+		t.Errorf("wrong output. got=%q", output)
+	}
+}
+
+func TestVMMode(t *testing.T) {
+	r := newTestREPL()
+
+	output := run(r, ":mode vm", "let add = fn(a, b) { a + b };", "add(2, 3)", "y")
+	expected := "5\nERROR: identifier not found: y\n"
+	if output != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot=%q", expected, output)
+	}
+}
+
+func TestReset(t *testing.T) {
+	for _, mode := range []string{"eval", "vm"} {
+		r := newTestREPL()
+
+		output := run(r, ":mode "+mode, "let x = 1;", ":reset", "x")
+		if output != "ERROR: identifier not found: x\n" {
+			t.Errorf("x survived :reset in %s mode. got=%q", mode, output)
+		}
+	}
+}
+
+func TestMetaCommands(t *testing.T) {
+	tests := []struct {
+		lines    []string
+		expected string
+	}{
+		{[]string{":tokens let x"}, "1:1 LET \"let\"\n1:5 IDENTIFIER \"x\"\n"},
+		{[]string{":parse 1 + 2 * 3"}, "(1 + (2 * 3))\n"},
+		{[]string{":ast x"}, "Program 1:1\n  Statements[0]: ExpressionStatement 1:1\n    Expression: Identifier \"x\" 1:1\n"},
+		{[]string{":errors 1 + 2"}, "no errors\n"},
+		{[]string{":mode"}, "mode: eval\n"},
+		{[]string{":mode ast", ":mode"}, "mode: ast\n"},
+		{[]string{":mode fast"}, "unknown mode \"fast\", want one of tokens, ast, eval, vm\n"},
+		{[]string{":nope"}, "unknown command :nope, try :help\n"},
+		{[]string{":mode tokens", "1"}, "1:1 INT \"1\"\n"},
+	}
+
+	for _, tt := range tests {
+		output := run(newTestREPL(), tt.lines...)
+		if output != tt.expected {
+			t.Errorf("wrong output for %q.\nwant=%q\ngot=%q", tt.lines, tt.expected, output)
+		}
+	}
+}
+
+func TestErrorsDefaultsToLastInput(t *testing.T) {
+	r := newTestREPL()
+	run(r, "let = 1;")
+
+	output := run(r, ":errors")
+	if !strings.HasPrefix(output, "error[") || !strings.Contains(output, "let = 1;") {
+		t.Errorf("expected the diagnostics for the last line. got=%q", output)
+	}
+}
+
+func TestRegisterCommand(t *testing.T) {
+	r := newTestREPL()
+	r.Register(Command{
+		Name: "shout",
+		Help: "repeat the arguments in capitals",
+		Run: func(r *REPL, args string) error {
+			_, err := r.Out.Write([]byte(strings.ToUpper(args) + "\n"))
+			return err
+		},
+	})
+
+	if output := run(r, ":shout  hello there "); output != "HELLO THERE\n" {
+		t.Errorf("wrong output. got=%q", output)
+	}
+
+	if output := run(r, ":help"); !strings.Contains(output, ":shout") || !strings.Contains(output, "repeat the arguments") {
+		t.Errorf(":help does not list the new command. got=%q", output)
+	}
+}
+
+func TestPanicIsReportedAndSessionContinues(t *testing.T) {
+	r := newTestREPL()
+	r.Register(Command{
+		Name: "crash",
+		Run: func(r *REPL, args string) error {
+			var values []int
+			return fmt.Errorf("unreachable %d", values[1])
+		},
+	})
+
+	output := run(r, "let x = 1;", ":crash", "x + 1")
+	expected := "ERROR: runtime error: index out of range [1] with length 0\n2\n"
+	if output != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot=%q", expected, output)
+	}
+}
+
+func TestLetPrintsNothing(t *testing.T) {
+	for _, mode := range []string{"eval", "vm"} {
+		r := newTestREPL()
+
+		output := run(r, ":mode "+mode, "1; let a = 2", "a")
+		if output != "2\n" {
+			t.Errorf("wrong output in %s mode. got=%q", mode, output)
+		}
+	}
+}
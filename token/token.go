@@ -1,10 +1,41 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type TokenType
 	Literal string
+	Pos Position // first character of the token
+	End Position // immediately after the last character of the token
+}
+
+// a location in the source. Line and Column start at 1, Offset is the byte
+// offset from the start of the input and starts at 0
+type Position struct {
+	Filename string `json:"filename,omitempty"`
+	Offset int `json:"offset"`
+	Line int `json:"line"`
+	Column int `json:"column"`
+}
+
+// the zero Position is used for nodes that were not produced by the lexer
+func (pos Position) IsValid() bool { return pos.Line > 0 }
+
+// formats as file:line:column, leaving out whatever is unknown
+func (pos Position) String() string {
+	s := pos.Filename
+	if pos.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	}
+	if s == "" {
+		s = "-"
+	}
+	return s
 }
 
 var keywords = map[string]TokenType {
@@ -15,6 +46,38 @@ var keywords = map[string]TokenType {
 	"true": TRUE,
 	"false": FALSE,
 	"return": RETURN,
+	"while": WHILE,
+	"for": FOR,
+	"break": BREAK,
+	"continue": CONTINUE,
+	"in": IN,
+}
+
+// operators spelled with more than one character. The lexer tries the
+// longest spelling first before falling back to a single character token
+var operators = map[string]TokenType {
+	"==": EQ,
+	"!=": NOT_EQ,
+	"<=": LT_EQ,
+	">=": GT_EQ,
+	"&&": AND,
+	"||": OR,
+	"<<": SHIFT_LEFT,
+	">>": SHIFT_RIGHT,
+	"+=": PLUS_ASSIGN,
+	"-=": MINUS_ASSIGN,
+	"*=": ASTERISK_ASSIGN,
+	"/=": SLASH_ASSIGN,
+	"..": DOTDOT,
+	"..=": DOTDOT_EQ,
+}
+
+// the longest operator in operators
+const MaxOperatorLength = 3
+
+func LookupOperator(literal string) (TokenType, bool) {
+	tok, ok := operators[literal]
+	return tok, ok
 }
 
 func LookupIdentifier(identifier string) TokenType {
@@ -27,29 +90,52 @@ func LookupIdentifier(identifier string) TokenType {
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF = "EOF"
+	COMMENT = "COMMENT" // only produced when the lexer is asked to keep comments
 
 	IDENTIFIER = "IDENTIFIER"
 	INT = "INT"
+	FLOAT = "FLOAT"
+	STRING = "STRING"
 
 	// operators
 	ASSIGN = "="
+	PLUS_ASSIGN = "+="
+	MINUS_ASSIGN = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN = "/="
 	PLUS = "+"
 	MINUS = "-"
 	BANG = "!"
 	ASTERISK = "*"
 	SLASH = "/"
+	PERCENT = "%"
 	LT = "<"
 	GT = ">"
 	COMMA = ","
 	SEMICOLON = ";"
+	COLON = ":"
 	EQ = "=="
 	NOT_EQ = "!="
+	LT_EQ = "<="
+	GT_EQ = ">="
+	AND = "&&"
+	OR = "||"
+	AMPERSAND = "&"
+	PIPE = "|"
+	CARET = "^"
+	TILDE = "~"
+	SHIFT_LEFT = "<<"
+	SHIFT_RIGHT = ">>"
+	DOTDOT = ".."
+	DOTDOT_EQ = "..="
 
 	// brackets
 	LPAREN = "("
 	RPAREN = ")"
 	LBRACE = "{"
 	RBRACE = "}"
+	LBRACKET = "["
+	RBRACKET = "]"
 
 	// keywords
 	FUNCTION = "FUNCTION"
@@ -59,4 +145,9 @@ const (
 	TRUE = "TRUE"
 	FALSE = "FALSE"
 	RETURN = "RETURN"
+	WHILE = "WHILE"
+	FOR = "FOR"
+	BREAK = "BREAK"
+	CONTINUE = "CONTINUE"
+	IN = "IN"
 )
\ No newline at end of file
@@ -0,0 +1,23 @@
+package vm
+
+import (
+	"github.com/gavwyh/go-interpreter/code"
+	"github.com/gavwyh/go-interpreter/object"
+)
+
+// a call in progress. Its locals are the NumLocals stack slots starting at
+// basePointer, the first of which hold the arguments, and the closure
+// being called sits just below them
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
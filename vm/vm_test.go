@@ -0,0 +1,211 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/gavwyh/go-interpreter/ast"
+	"github.com/gavwyh/go-interpreter/compiler"
+	"github.com/gavwyh/go-interpreter/evaluator"
+	"github.com/gavwyh/go-interpreter/lexer"
+	"github.com/gavwyh/go-interpreter/object"
+	"github.com/gavwyh/go-interpreter/parser"
+)
+
+// every program runs through both Eval and the vm, which must agree on the
+// result, or on the error message
+var conformance = []string{
+	// arithmetic and comparison
+	"5", "-10", "2 * (5 + 10) / 3", "7 % 3", "-7 % 3", "7.5 % 2", "5 / 0", "5 % 0",
+	"1.5 + 2", "3 / 2.0", "0.1 + 0.2", "2.0 * 3",
+	"6 & 3", "6 | 3", "6 ^ 3", "~5", "1 << 10", "-16 >> 2", "1 << -1", "1 << 64",
+	"9223372036854775807 + 1", "-9223372036854775808 - 1", "9223372036854775807 * 2",
+	"18446744073709551616 - 18446744073709551615", "18446744073709551616 / 2.0",
+	"1 < 2", "1 > 2", "1 <= 1", "2 >= 3", "1 == 1", "1 != 1", "1 == 1.0",
+	"true == true", "true != false", "(1 < 2) == true", "null == null",
+	"!true", "!!5", "!null", "-true", "~1.5",
+	`"a" + "b"`, `"a" == "a"`, `"a" < "b"`, `"a" - "b"`, `1 + "a"`, "true + false",
+
+	// logical operators
+	"true && false", "0 && 1", "null || 1", "false || false",
+	"let x = 0; false && (x = 1); x", "let x = 0; true || (x = 1); x",
+
+	// conditionals
+	"if (true) { 10 }", "if (false) { 10 }", "if (1 < 2) { 10 } else { 20 }",
+	"if (null) { 1 } else { 2 }", "if (if (false) { 10 }) { 10 } else { 20 }",
+	"if (true) { 1; 2 }",
+	"if (true) {}", "if (false) { 1 } else {}", "if (true) { let x = 1; }", "(if (true) {}) + 1", "-if (true) {}",
+	"let x = if (true) {}; x", "let y = if (true) { let x = 1 }; y + 1", "let f = fn() { return if (true) {} }; f()",
+
+	// let, return and assignment
+	"let a = 5; let b = a; let c = a + b + 5; c", "let x = 1; let x = x + 1; x",
+	"return 10; 9", "9; return 2 * 5; 9", "if (10 > 1) { if (10 > 1) { return 10; } return 1; }",
+	"let x = 1; x = 2; x", "let x = 5; x += 2; x", "let x = 5; (x -= 2) * 2",
+	"let x = 2; x *= 3; x /= 2; x", "let a = 1; let b = 2; a = b = 3; a + b",
+	"y = 1", "y += 1", "unknown", `let s = "a"; s += "b"; s`, "let x = 1; x += true",
+	"let xs = [1, 2, 3]; xs[0] = 10; xs", "let xs = [1, 2, 3]; xs[-1] += 5; xs",
+	"let xs = [1]; xs[5] = 1", `let h = {"a": 1}; h["a"] += 1; h["b"] = 3; h`,
+	`let h = {}; h["a"] += 1`, `let s = "ab"; s[0] = "c"`,
+
+	// functions and closures
+	"let identity = fn(x) { x; }; identity(5);", "fn(x) { return x * 2; }(5)",
+	"let add = fn(a, b) { a + b }; add(5, add(5, 5))", "fn() {}()", "fn(x) {}(1)",
+	"fn(x) { x }()", "let f = 1; f()", "let x = 10; let f = fn() { let x = 5; x }; f() + x",
+	"let newAdder = fn(x) { fn(y) { x + y } }; let addTwo = newAdder(2); addTwo(3)",
+	"let f = fn(a) { fn(b) { fn(c) { a + b + c } } }; f(1)(2)(3)",
+	"let counter = fn() { let count = 0; fn() { count += 1 } }; let c = counter(); c(); c(); c()",
+	"let make = fn() { let n = 0; let inc = fn() { n += 1 }; let get = fn() { n }; [inc, get] }; let p = make(); p[0](); p[0](); p[1]()",
+	"let total = 0; let add = fn(n) { total += n }; add(3); add(4); total",
+	"let x = 1; let f = fn() { x }; let x = 2; f()",
+	"let f = fn() { g() }; let g = fn() { 42 }; f()", "let f = fn() { g() }; f()",
+	"let map = fn(xs, f) { let out = []; for (x in xs) { out = push(out, f(x)) } out }; map([1, 2, 3], fn(x) { x * x })",
+	"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)",
+	"let outer = fn() { let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } }; fact(20) }; outer()",
+	"let f = fn(x) { let x = x * 2; x }; f(4)",
+
+	// tail calls
+	"let count = fn(n) { if (n == 0) { return 0; } count(n - 1) }; count(100000)",
+	"let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; even(100001)",
+	"let f = fn(n) { len([n]) }; f(1)", "let f = fn() { 1() }; f()", "let f = fn(a) { f() }; f(1)",
+
+	// arrays, hashes and indexing
+	"[1, 2 * 2, 3 + 3]", "[1, 2, 3][1]", "[1, 2, 3][-1]", "[1, 2, 3][3]", "[1][true]",
+	`{"one": 1, "two": 2}`, `{1: "a", true: "b"}["x"]`, `{"a": 1}["a"]`, `{[1]: 2}`, `{"a": 1}[fn(x) { x }]`,
+	`"hello"[1]`, `len("héllo")`, `len([1, 2])`, `len({"a": 1})`, "len(1)", "len()",
+	"push([1], 2)", "let a = [1]; let b = push(a, 2); a", "push(1, 2)", "len",
+
+	// loops
+	"let i = 0; while (i < 10) { i += 1 } i", "let s = 0; for (let i = 0; i < 5; i += 1) { s += i } s",
+	"let i = 42; for (let i = 0; i < 3; i += 1) {} i",
+	"let s = 0; for (let i = 0; i < 10; i += 1) { if (i == 5) { break; } if (i % 2 == 0) { continue; } s += i } s",
+	"let s = 0; for (x in [1, 2, 3]) { s += x } s", "let s = 0; for (i, x in [10, 20]) { s += i * x } s",
+	`let out = ""; for (c in "héllo") { out = c + out } out`,
+	`let ks = []; for (k in {"a": 1, "b": 2}) { ks = push(ks, k) } ks`,
+	`let vs = []; for (k, v in {"a": 1, "b": 2}) { vs = push(vs, [k, v]) } vs`,
+	"let s = 0; for (i in 0..10) { s += i } s", "let s = 0; for (i in 1..=10) { s += i } s",
+	"1..5", "1..=5", "1..true", `for (x in 5) {}`,
+	"let fs = []; for (i in 0..3) { fs = push(fs, fn() { i }) } fs[0]() + fs[2]()",
+	"let fs = []; for (i in 0..3) { let j = i * 10; fs = push(fs, fn() { j }) } fs[1]()",
+	"let f = fn() { let fs = []; for (i in 0..3) { fs = push(fs, fn() { i }) } fs }; let fs = f(); fs[0]() + fs[1]() + fs[2]()",
+	"let fs = []; let i = 0; while (i < 3) { fs = push(fs, fn() { i }); i += 1 } fs[0]()",
+	"let s = 0; for (i in 0..3) { for (j in 0..3) { if (j == 2) { break; } s += 1 } } s",
+	"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 100; } } 0 }; f()",
+	"let f = fn() { let i = 0; while (true) { i += 1; if (i == 7) { return i; } } }; f()",
+	"let f = fn(n) { let s = 0; for (let i = 0; i < n; i += 1) { s += i } s }; f(10) + f(5)",
+	"while (false) {}", "for (x in []) {}",
+	"if (true) { for (x in [1]) {} }",
+
+	// break, continue and return inside expressions
+	"for (i in 0..3) { 1 + if (true) { continue } }",
+	"let s = 0; for (i in 0..3) { 1 + if (true) { continue }; s += 1 } s",
+	"let s = 0; for (i in 0..5) { let a = [1, if (i == 2) { break }]; s += 1 } s",
+	`let s = 0; for (i in 0..5) { let h = {"k": if (i == 3) { break }}; s += 1 } s`,
+	"let f = fn(x) { x }; let i = 0; while (i < 3) { i += 1; f(if (true) { continue }) } i",
+	"let s = 0; let i = 0; while (i < 3) { i += 1; s += if (i == 2) { continue } else { i } } s",
+	"let xs = [0]; for (i in 0..4) { xs[0] += if (i == 1) { continue } else { i } } xs",
+	"let s = 0; for (x in [1, 2]) { for (i in 0..if (x == 2) { break } else { 3 }) { s += 1 } } s",
+	"let s = 0; for (let i = 0; i < 3; i += 1) { [1][if (i == 1) { break } else { 0 }]; s += 1 } s",
+	"let f = fn() { 1 + if (true) { return 5 } }; f()",
+	"let f = fn() { for (i in 0..3) { let x = [i, if (i == 1) { return i * 10 }] } }; f()",
+
+	// statements without a value
+	"1; let a = 2", "let a = 1; a; let b = 2",
+}
+
+func TestConformance(t *testing.T) {
+	for _, input := range conformance {
+		program := parse(t, input)
+
+		expected := inspect(evaluator.Eval(program, object.NewEnvironment()), nil)
+		actual := inspect(runVM(program))
+
+		if actual != expected {
+			t.Errorf("vm and evaluator disagree on %q.\nevaluator=%s\nvm=%s", input, expected, actual)
+		}
+	}
+}
+
+func TestDeepTailRecursion(t *testing.T) {
+	input := "let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } }; count(1000000, 0)"
+
+	result, err := runVM(parse(t, input))
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if result.Inspect() != "1000000" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+}
+
+func TestDeepRecursionOverflows(t *testing.T) {
+	input := "let f = fn(n) { 1 + f(n + 1) }; f(0)"
+
+	_, err := runVM(parse(t, input))
+	if err == nil || err.Error() != "stack overflow" {
+		t.Errorf("expected stack overflow. got=%v", err)
+	}
+}
+
+func TestGlobalsPersistAcrossRuns(t *testing.T) {
+	symbolTable := compiler.NewSymbolTable()
+	for i, builtin := range evaluator.Builtins {
+		symbolTable.DefineBuiltin(i, builtin.Name)
+	}
+	var constants []object.Object
+	globals := make([]object.Object, GlobalsSize)
+
+	lines := []string{"let x = 1;", "let add = fn(n) { x += n };", "add(2); x"}
+
+	var result object.Object
+	for _, line := range lines {
+		c := compiler.NewWithState(symbolTable, constants)
+		if err := c.Compile(parse(t, line)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		bytecode := c.Bytecode()
+		constants = bytecode.Constants
+
+		machine := NewWithGlobalsStore(bytecode, globals)
+		if err := machine.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		result = machine.LastPoppedStackElem()
+	}
+
+	if result.Inspect() != "3" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func runVM(program *ast.Program) (object.Object, error) {
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		return nil, err
+	}
+
+	machine := New(c.Bytecode())
+	if err := machine.Run(); err != nil {
+		return nil, err
+	}
+	return machine.LastPoppedStackElem(), nil
+}
+
+// describes a result the way the evaluator's Error.Inspect does, so that
+// errors from either side compare equal
+func inspect(result object.Object, err error) string {
+	if err != nil {
+		return "ERROR: " + err.Error()
+	}
+	if result == nil {
+		return "<nil>"
+	}
+	return result.Inspect()
+}